@@ -1,9 +1,42 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/yaso195/crypto-arbitrage/server"
 )
 
+// Heroku kills the process 30 seconds after SIGTERM.
+const SHUTDOWN_TIMEOUT = 25 * time.Second
+
 func main() {
-	server.Run()
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("$PORT must be set")
+	}
+
+	options := []server.Option{server.WithAddr(":" + port)}
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		options = append(options, server.WithConfigFile(configFile))
+	}
+
+	s := server.NewServer(options...)
+	if err := s.Start(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	log.Println("Shutting down on ", <-signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiQuote struct {
+	Currency     string    `json:"currency"`
+	Ask          float64   `json:"ask"`
+	Bid          float64   `json:"bid"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	ExchangeTime time.Time `json:"exchangeTime,omitempty"`
+	Stale        bool      `json:"stale"`
+}
+
+type apiDiffSide struct {
+	Percent    float64 `json:"percent"`
+	NetPercent float64 `json:"netPercent"`
+	Price      float64 `json:"price"`
+}
+
+type apiDiff struct {
+	Reference string      `json:"reference"`
+	Currency  string      `json:"currency"`
+	Ask       apiDiffSide `json:"ask"`
+	Bid       apiDiffSide `json:"bid"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	Stale     bool        `json:"stale"`
+}
+
+type apiSpread struct {
+	Percent   float64   `json:"percent"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type apiRate struct {
+	Rate      float64        `json:"rate"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Sources   []FxSourceRate `json:"sources"`
+}
+
+func (s *Server) addAPIRoutes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	v1.GET("/prices", s.GetPrices)
+	v1.GET("/diffs", s.GetDiffs)
+	v1.GET("/spreads", s.GetSpreads)
+	v1.GET("/fx", s.GetFx)
+	v1.GET("/depth", s.GetDepths)
+	v1.GET("/history", s.GetHistory)
+	v1.GET("/feeds", s.GetFeeds)
+	v1.GET("/http", s.GetHTTPStats)
+	v1.GET("/triangles", s.GetTriangles)
+	v1.GET("/matrix", s.GetSpreadMatrix)
+	v1.GET("/leaders", s.GetLeaders)
+	v1.GET("/rules", s.GetRules)
+	v1.GET("/rules/:id", s.GetRule)
+	v1.POST("/rules", s.CreateRule)
+	v1.PUT("/rules/:id", s.UpdateRule)
+	v1.DELETE("/rules/:id", s.DeleteRule)
+}
+
+// GetPrices returns the latest quotes keyed by exchange and symbol, including
+// the reference quotes the diffs are computed against.
+func (s *Server) GetPrices(c *gin.Context) {
+	cfg := s.currentConfig()
+	now := s.clock.Now()
+	result := map[string]map[string]apiQuote{}
+	add := func(p Price) {
+		if _, ok := result[p.Exchange]; !ok {
+			result[p.Exchange] = map[string]apiQuote{}
+		}
+		result[p.Exchange][p.ID] = apiQuote{
+			Currency:     p.Currency,
+			Ask:          p.Ask,
+			Bid:          p.Bid,
+			UpdatedAt:    p.ReceivedAt,
+			ExchangeTime: p.ExchangeTime,
+			Stale:        s.isStale(cfg, p, now),
+		}
+	}
+
+	m := s.store.Snapshot()
+
+	s.mux.Lock()
+	for _, symbol := range m.Symbols {
+		if p, ok := m.CoinbaseProPrices[symbol]; ok && p.Exchange == GDAX {
+			add(p)
+		}
+	}
+	for _, p := range m.BinancePrices {
+		add(p)
+	}
+	for _, e := range s.activeExchanges(cfg) {
+		for _, p := range m.ExchangePrices[e.Name()] {
+			add(p)
+		}
+	}
+	s.mux.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"time": now, "prices": result})
+}
+
+// GetDiffs returns the ask and bid premiums of every venue against its
+// reference, keyed by exchange and symbol.
+func (s *Server) GetDiffs(c *gin.Context) {
+	cfg := s.currentConfig()
+	result := map[string]map[string]apiDiff{}
+
+	m := s.store.Snapshot()
+	for _, e := range s.activeExchanges(cfg) {
+		for _, symbol := range e.Symbols() {
+			reference, ok := m.CoinbaseProPrices[symbol]
+			if !ok {
+				continue
+			}
+
+			askKey := fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Ask")
+			bidKey := fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Bid")
+			askDiff, ok := m.Diffs[askKey]
+			if !ok {
+				continue
+			}
+
+			if _, ok := result[e.Name()]; !ok {
+				result[e.Name()] = map[string]apiDiff{}
+			}
+			result[e.Name()][symbol] = apiDiff{
+				Reference: reference.Exchange,
+				Currency:  e.Currency(),
+				Ask:       apiDiffSide{Percent: askDiff, NetPercent: m.NetDiffs[askKey], Price: m.Prices[fmt.Sprintf("%s-%s-%s", e.Name(), symbol, "Ask")]},
+				Bid:       apiDiffSide{Percent: m.Diffs[bidKey], NetPercent: m.NetDiffs[bidKey], Price: m.Prices[fmt.Sprintf("%s-%s-%s", e.Name(), symbol, "Bid")]},
+				UpdatedAt: m.QuoteTimes[e.Name()+"-"+symbol],
+				Stale:     m.StaleQuotes[reference.Exchange+"-"+symbol] || m.StaleQuotes[e.Name()+"-"+symbol],
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "diffs": result})
+}
+
+// GetSpreads returns the bid/ask spread of the reference exchanges in percent.
+func (s *Server) GetSpreads(c *gin.Context) {
+	result := map[string]map[string]apiSpread{}
+
+	m := s.store.Snapshot()
+	for _, exchange := range []string{GDAX, BINANCE} {
+		for _, symbol := range m.Symbols {
+			spread, ok := m.Spreads[exchange+symbol]
+			if !ok {
+				continue
+			}
+
+			if _, ok := result[exchange]; !ok {
+				result[exchange] = map[string]apiSpread{}
+			}
+			result[exchange][symbol] = apiSpread{Percent: spread, UpdatedAt: m.QuoteTimes[exchange+"-"+symbol]}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "spreads": result})
+}
+
+// GetFx returns the USD conversion rates used for the local currency diffs.
+func (s *Server) GetFx(c *gin.Context) {
+	cfg := s.currentConfig()
+
+	s.mux.Lock()
+	rates := map[string]apiRate{}
+	for _, currency := range s.fxCurrencies(cfg) {
+		rates[currency] = apiRate{Rate: s.usdRate(currency), UpdatedAt: s.rateTimes[currency], Sources: s.fxSources[currency]}
+	}
+	implied := map[string]float64{}
+	for currency, rate := range s.impliedRates {
+		implied[currency] = rate
+	}
+	s.mux.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "base": "USD", "rates": rates, "implied": implied, "referenceMode": cfg.FX.ReferenceMode})
+}
+
+// GetDepths returns the executable premiums for the configured notionals,
+// keyed by exchange and symbol. Every symbol of the active exchanges is
+// listed, the ones without an analysis with DEPTH_UNKNOWN.
+func (s *Server) GetDepths(c *gin.Context) {
+	cfg := s.currentConfig()
+	result := map[string]map[string]DepthAnalysis{}
+	for _, e := range s.activeExchanges(cfg) {
+		result[e.Name()] = map[string]DepthAnalysis{}
+		for _, symbol := range e.Symbols() {
+			result[e.Name()][symbol] = DepthAnalysis{Exchange: e.Name(), Symbol: symbol, Currency: e.Currency(), Status: DEPTH_UNKNOWN}
+		}
+	}
+
+	s.mux.Lock()
+	for _, d := range s.depths {
+		if _, ok := result[d.Exchange]; !ok {
+			result[d.Exchange] = map[string]DepthAnalysis{}
+		}
+		result[d.Exchange][d.Symbol] = d
+	}
+	s.mux.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "depth": result})
+}
+
+// GetFeeds returns the connection state of the streaming reference feeds.
+func (s *Server) GetFeeds(c *gin.Context) {
+	s.mux.Lock()
+	feeds := map[string]FeedState{GDAX: s.coinbaseProState}
+	s.mux.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "feeds": feeds})
+}
+
+// GetHTTPStats returns the request accounting of every exchange and rate
+// source. The latencies are in nanoseconds.
+func (s *Server) GetHTTPStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "sources": s.httpClient.Stats()})
+}
+
+// GetTriangles returns the triangular cycle returns of the exchanges with
+// BTC-quoted books.
+func (s *Server) GetTriangles(c *gin.Context) {
+	cfg := s.currentConfig()
+	list := s.sortedTriangles(s.store.Snapshot(), cfg)
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "triangles": list})
+}
+
+// GetSpreadMatrix returns the pair spreads between every two venues, per
+// symbol. The currency parameter limits them to the venues of one currency
+// and symbol to one symbol.
+func (s *Server) GetSpreadMatrix(c *gin.Context) {
+	cfg := s.currentConfig()
+	symbol := strings.ToUpper(c.Query("symbol"))
+	m := s.store.Snapshot()
+
+	s.mux.Lock()
+	matrices := s.spreadMatrices(m, cfg, strings.ToUpper(c.Query("currency")), s.clock.Now())
+	s.mux.Unlock()
+
+	var result []SpreadMatrix
+	for _, matrix := range matrices {
+		if symbol == "" || matrix.Symbol == symbol {
+			result = append(result, matrix)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "matrices": result})
+}
+
+// GetLeaders returns the cheapest symbol to buy and the richest one to sell
+// on every exchange, with the latest limit leader changes of the last
+// LEADER_HISTORY.
+func (s *Server) GetLeaders(c *gin.Context) {
+	limit := LEADER_CHANGES_QUERY_LIMIT
+	if limitStr := c.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 || limit > LEADER_CHANGES_LIMIT {
+			c.String(http.StatusBadRequest, "limit must be between 1 and %d", LEADER_CHANGES_LIMIT)
+			return
+		}
+	}
+
+	cfg := s.currentConfig()
+	s.mux.Lock()
+	list := s.sortedLeaders(cfg)
+	changes := s.leaderChanges
+	if len(changes) > limit {
+		changes = changes[len(changes)-limit:]
+	}
+	changes = append([]LeaderChange{}, changes...)
+	s.mux.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "leaders": list, "changes": changes})
+}
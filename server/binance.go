@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	BINANCE_URI = "https://api.binance.com/api/v3/ticker/bookTicker?symbol=%s%s"
+)
+
+// binanceExchange is not registered as a venue, it is the reference feed for
+// the symbols Coinbase Pro does not list. It publishes its spreads to the
+// market store.
+type binanceExchange struct {
+	venue
+	market *MarketStore
+}
+
+func (binanceExchange) Name() string {
+	return BINANCE
+}
+
+func (binanceExchange) Currency() string {
+	return "USD"
+}
+
+func (e binanceExchange) Symbols() []string {
+	return e.config().References.Binance
+}
+
+// FetchTickers publishes the spreads of the fetched symbols in one update of
+// the market store.
+func (e binanceExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	var mu sync.Mutex
+	spreads := map[string]float64{}
+	prices, err := e.fetchSymbols(ctx, BINANCE, e.Symbols(), func(ctx context.Context, currency string) (Price, error) {
+		var uri string
+		if currency == "USDT" {
+			uri = fmt.Sprintf(BINANCE_URI, "USDC", currency)
+		} else if currency == "XRP" || currency == "XLM" {
+			uri = fmt.Sprintf(BINANCE_URI, currency, "USDC")
+		} else {
+			uri = fmt.Sprintf(BINANCE_URI, currency, "BTC")
+		}
+
+		responseData, err := e.httpGet(ctx, BINANCE, uri)
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to get Binance response : %s", err)
+		}
+
+		priceAsk, err := jsonparser.GetString(responseData, "askPrice")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the ask price from the Binance response data: %s", err)
+		}
+		pAsk, _ := strconv.ParseFloat(priceAsk, 64)
+
+		priceBid, err := jsonparser.GetString(responseData, "bidPrice")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the bid price from the Binance response data: %s", err)
+		}
+		pBid, _ := strconv.ParseFloat(priceBid, 64)
+
+		mu.Lock()
+		spreads[BINANCE+currency] = (pAsk - pBid) * 100 / pBid
+		mu.Unlock()
+
+		if currency == "USDT" {
+			return Price{Exchange: BINANCE, Currency: "USD", ID: currency, Ask: 1 / pAsk, Bid: 1 / pBid}, nil
+		}
+		return Price{Exchange: BINANCE, Currency: "USD", ID: currency, Ask: pAsk, Bid: pBid}, nil
+	})
+
+	// The spreads of the symbols fetched before a failure are kept.
+	if len(spreads) > 0 {
+		e.market.Update(func(next *MarketState) {
+			for key, spread := range spreads {
+				next.Spreads[key] = spread
+			}
+		})
+	}
+	return prices, err
+}
+
+func (s *Server) getBinanceDOGEVolumes(ctx context.Context) error {
+	responseData, err := s.httpClient.Get(ctx, BINANCE, fmt.Sprintf(BINANCE_URI, "DOGE", "BTC"))
+	if err != nil {
+		return fmt.Errorf("failed to get Binance DOGE volume response : %s", err)
+	}
+
+	priceAsk, err := jsonparser.GetString(responseData, "askPrice")
+	if err != nil {
+		return fmt.Errorf("failed to read the ask price from the Binance response data: %s", err)
+	}
+	pAsk, _ := strconv.ParseFloat(priceAsk, 64)
+
+	askVolumeSizeStr, err := jsonparser.GetString(responseData, "askQty")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE ask volume size from the Binance response data: %s", err)
+	}
+	askVolumeSize, _ := strconv.ParseFloat(askVolumeSizeStr, 64)
+
+	priceBid, err := jsonparser.GetString(responseData, "bidPrice")
+	if err != nil {
+		return fmt.Errorf("failed to read the bid price from the Binance response data: %s", err)
+	}
+	pBid, _ := strconv.ParseFloat(priceBid, 64)
+
+	bidVolumeSizeStr, err := jsonparser.GetString(responseData, "bidQty")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE bid volume size from the Binance response data: %s", err)
+	}
+	bidVolumeSize, _ := strconv.ParseFloat(bidVolumeSizeStr, 64)
+
+	s.store.Update(func(next *MarketState) {
+		next.DOGEVolumes["BinanceAsk"] = pAsk * askVolumeSize
+		next.DOGEVolumes["BinanceBid"] = pBid * bidVolumeSize
+		next.Prices["BinanceDOGEAsk"] = pAsk
+		next.Prices["BinanceDOGEBid"] = pBid
+	})
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	BITFINEX_URI      = "https://api.bitfinex.com/v1/pubticker/%s%s"
+	BITFINEX_BOOK_URI = "https://api.bitfinex.com/v1/book/%s%s?limit_bids=%d&limit_asks=%d"
+)
+
+var (
+	bitfinexCurrencies = []string{"BTC", "ETH", "LTC", "XRP", "XLM"}
+)
+
+type bitfinexExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return bitfinexExchange{v} })
+}
+
+func (bitfinexExchange) Name() string {
+	return BITFINEX
+}
+
+func (e bitfinexExchange) Currency() string {
+	return e.configuredCurrency(BITFINEX, "USD")
+}
+
+func (e bitfinexExchange) Symbols() []string {
+	return e.configuredSymbols(BITFINEX, bitfinexCurrencies)
+}
+
+func (e bitfinexExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	quote := e.Currency()
+	return e.fetchSymbols(ctx, BITFINEX, e.Symbols(), func(ctx context.Context, currency string) (Price, error) {
+		responseData, err := e.httpGet(ctx, BITFINEX, fmt.Sprintf(BITFINEX_URI, currency, quote))
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to get Bitfinex response : %s", err)
+		}
+
+		priceAsk, err := jsonparser.GetString(responseData, "ask")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the ask price from the Bitfinex response data: %s", err)
+		}
+		pAsk, _ := strconv.ParseFloat(priceAsk, 64)
+
+		priceBid, err := jsonparser.GetString(responseData, "bid")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the bid price from the Bitfinex response data: %s", err)
+		}
+		pBid, _ := strconv.ParseFloat(priceBid, 64)
+
+		// The timestamp is optional, a quote without it is only aged locally.
+		exchangeTime, _ := parseUnixTime(responseData, false, "timestamp")
+
+		return Price{Exchange: BITFINEX, Currency: quote, ID: currency, Ask: pAsk, Bid: pBid, ExchangeTime: exchangeTime}, nil
+	})
+}
+
+func (e bitfinexExchange) FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error) {
+	book := OrderBook{Exchange: BITFINEX, Currency: e.Currency(), ID: symbol}
+
+	responseData, err := e.httpGet(ctx, BITFINEX, fmt.Sprintf(BITFINEX_BOOK_URI, symbol, book.Currency, depth, depth))
+	if err != nil {
+		return book, fmt.Errorf("failed to get Bitfinex order book response : %s", err)
+	}
+
+	book.Asks, err = parseOrderBookLevels(responseData, "price", "amount", "asks")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the asks from the Bitfinex response data: %s", err)
+	}
+
+	book.Bids, err = parseOrderBookLevels(responseData, "price", "amount", "bids")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the bids from the Bitfinex response data: %s", err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	BITOASIS_URI = "https://api.bitoasis.net/v1/exchange/ticker/%s-%s"
+)
+
+var (
+	bitoasisCurrencies = []string{"BTC", "ETH", "LTC", "XLM", "XRP", "BCH"}
+)
+
+type bitoasisExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return bitoasisExchange{v} })
+}
+
+func (bitoasisExchange) Name() string {
+	return BITOASIS
+}
+
+func (e bitoasisExchange) Currency() string {
+	return e.configuredCurrency(BITOASIS, "AED")
+}
+
+func (e bitoasisExchange) Symbols() []string {
+	return e.configuredSymbols(BITOASIS, bitoasisCurrencies)
+}
+
+func (e bitoasisExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	quote := e.Currency()
+	return e.fetchSymbols(ctx, BITOASIS, e.Symbols(), func(ctx context.Context, currency string) (Price, error) {
+		responseData, err := e.httpGet(ctx, BITOASIS, fmt.Sprintf(BITOASIS_URI, currency, quote))
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to get Bitoasis response : %s", err)
+		}
+
+		priceAsk, err := jsonparser.GetString(responseData, "ticker", "ask")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the ask price from the Bitoasis response data: %s", err)
+		}
+		pAsk, _ := strconv.ParseFloat(priceAsk, 64)
+
+		priceBid, err := jsonparser.GetString(responseData, "ticker", "bid")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the bid price from the Bitoasis response data: %s", err)
+		}
+		pBid, _ := strconv.ParseFloat(priceBid, 64)
+
+		return Price{Exchange: BITOASIS, Currency: quote, ID: currency, Ask: pAsk, Bid: pBid}, nil
+	})
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	BITTREX_URI             = "https://bittrex.com/api/v1.1/public/getticker?market=%s-%s"
+	BITTREX_DOGE_VOLUME_URI = "https://bittrex.com/api/v1.1/public/getorderbook?market=BTC-DOGE&type=both"
+)
+
+func (s *Server) getBittrexDOGEVolumes(ctx context.Context) error {
+	responseData, err := s.httpClient.Get(ctx, BITTREX, BITTREX_DOGE_VOLUME_URI)
+	if err != nil {
+		return fmt.Errorf("failed to get Bittrex DOGE volume response : %s", err)
+	}
+
+	pAsk, err := jsonparser.GetFloat(responseData, "result", "sell", "[0]", "Rate")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE ask price from the Bittrex response data: %s", err)
+	}
+
+	askVolumeSize, err := jsonparser.GetFloat(responseData, "result", "sell", "[0]", "Quantity")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE ask volume size from the Bittrex response data: %s", err)
+	}
+
+	pBid, err := jsonparser.GetFloat(responseData, "result", "buy", "[0]", "Rate")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE bid price from the Bittrex response data: %s", err)
+	}
+
+	bidVolumeSize, err := jsonparser.GetFloat(responseData, "result", "buy", "[0]", "Quantity")
+	if err != nil {
+		return fmt.Errorf("failed to read the DOGE bid volume size from the Bittrex response data: %s", err)
+	}
+
+	s.store.Update(func(next *MarketState) {
+		next.DOGEVolumes["BittrexAsk"] = pAsk * askVolumeSize
+		next.DOGEVolumes["BittrexBid"] = pBid * bidVolumeSize
+		next.Prices["BittrexDOGEAsk"] = pAsk
+		next.Prices["BittrexDOGEBid"] = pBid
+	})
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	BTCTURK_URI           = "https://api.btcturk.com/api/v2/ticker"
+	BTCTURK_ORDERBOOK_URI = "https://api.btcturk.com/api/v2/orderbook?pairSymbol=%s%s&limit=%d"
+)
+
+var (
+	btcTurkCurrencies      = []string{"BTC", "ETH", "LTC", "XRP", "XLM", "USDT", "LINK"}
+	btcTurkCrossCurrencies = []string{"ETH", "LTC", "XRP", "XLM", "LINK"}
+)
+
+type btcTurkExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return btcTurkExchange{v} })
+}
+
+func (btcTurkExchange) Name() string {
+	return BTCTURK
+}
+
+func (e btcTurkExchange) Currency() string {
+	return e.configuredCurrency(BTCTURK, "TRY")
+}
+
+func (e btcTurkExchange) Symbols() []string {
+	return e.configuredSymbols(BTCTURK, btcTurkCurrencies)
+}
+
+func (e btcTurkExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, e.Currency(), e.Symbols())
+}
+
+func (e btcTurkExchange) FetchCrossTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, "BTC", btcTurkCrossCurrencies)
+}
+
+// The ticker endpoint lists every pair, only the symbols quoted in quote are
+// returned.
+func (e btcTurkExchange) fetchTickers(ctx context.Context, quote string, symbols []string) ([]Price, error) {
+	var prices []Price
+
+	responseData, err := e.httpGet(ctx, BTCTURK, BTCTURK_URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get BTCTurk response : %s", err)
+	}
+
+	pairs := map[string]string{}
+	for _, id := range symbols {
+		pairs[id+quote] = id
+	}
+
+	var returnError error
+	jsonparser.ArrayEach(responseData, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		pairName, err := jsonparser.GetString(value, "pair")
+		if err != nil {
+			returnError = fmt.Errorf("failed to read BTCTurk pairname from the response data : %s", err)
+			return
+		}
+
+		pair, ok := pairs[pairName]
+		if !ok {
+			return
+		}
+
+		priceAsk, err := jsonparser.GetFloat(value, "ask")
+		if err != nil {
+			returnError = fmt.Errorf("failed to read the %s ask price from the BTCTurk response data: %s", pair, err)
+			return
+		}
+
+		priceBid, err := jsonparser.GetFloat(value, "bid")
+		if err != nil {
+			returnError = fmt.Errorf("failed to read the %s bid price from the BTCTurk response data: %s", pair, err)
+			return
+		}
+		exchangeTime, _ := parseUnixTime(value, true, "timestamp")
+		prices = append(prices, Price{Exchange: BTCTURK, Currency: quote, ID: pair, Ask: priceAsk, Bid: priceBid, ExchangeTime: exchangeTime})
+
+	}, "data")
+
+	if returnError != nil {
+		return nil, returnError
+	}
+
+	return prices, nil
+}
+
+func (e btcTurkExchange) FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error) {
+	book := OrderBook{Exchange: BTCTURK, Currency: e.Currency(), ID: symbol}
+
+	responseData, err := e.httpGet(ctx, BTCTURK, fmt.Sprintf(BTCTURK_ORDERBOOK_URI, symbol, book.Currency, depth))
+	if err != nil {
+		return book, fmt.Errorf("failed to get BTCTurk order book response : %s", err)
+	}
+
+	book.Asks, err = parseOrderBookLevels(responseData, "[0]", "[1]", "data", "asks")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the %s asks from the BTCTurk response data: %s", symbol, err)
+	}
+
+	book.Bids, err = parseOrderBookLevels(responseData, "[0]", "[1]", "data", "bids")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the %s bids from the BTCTurk response data: %s", symbol, err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	CEXIO_URI      = "https://cex.io/api/ticker/%s/%s"
+	CEXIO_BOOK_URI = "https://cex.io/api/order_book/%s/%s/?depth=%d"
+)
+
+var (
+	cexioCurrencies = []string{"BTC", "ETH", "LTC", "BCH", "XRP", "XLM"}
+)
+
+type cexioExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return cexioExchange{v} })
+}
+
+func (cexioExchange) Name() string {
+	return CEXIO
+}
+
+func (e cexioExchange) Currency() string {
+	return e.configuredCurrency(CEXIO, "USD")
+}
+
+func (e cexioExchange) Symbols() []string {
+	return e.configuredSymbols(CEXIO, cexioCurrencies)
+}
+
+func (e cexioExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	quote := e.Currency()
+	return e.fetchSymbols(ctx, CEXIO, e.Symbols(), func(ctx context.Context, currency string) (Price, error) {
+		responseData, err := e.httpGet(ctx, CEXIO, fmt.Sprintf(CEXIO_URI, currency, quote))
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to get Cexio response : %s", err)
+		}
+
+		pAsk, err := jsonparser.GetFloat(responseData, "ask")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the ask price from the Cexio response data: %s", err)
+		}
+
+		pBid, err := jsonparser.GetFloat(responseData, "bid")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the bid price from the Cexio response data: %s", err)
+		}
+
+		exchangeTime, _ := parseUnixTime(responseData, false, "timestamp")
+
+		return Price{Exchange: CEXIO, Currency: quote, ID: currency, Ask: pAsk, Bid: pBid, ExchangeTime: exchangeTime}, nil
+	})
+}
+
+func (e cexioExchange) FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error) {
+	book := OrderBook{Exchange: CEXIO, Currency: e.Currency(), ID: symbol}
+
+	responseData, err := e.httpGet(ctx, CEXIO, fmt.Sprintf(CEXIO_BOOK_URI, symbol, book.Currency, depth))
+	if err != nil {
+		return book, fmt.Errorf("failed to get Cexio order book response : %s", err)
+	}
+
+	book.Asks, err = parseOrderBookLevels(responseData, "[0]", "[1]", "asks")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the asks from the Cexio response data: %s", err)
+	}
+
+	book.Bids, err = parseOrderBookLevels(responseData, "[0]", "[1]", "bids")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the bids from the Cexio response data: %s", err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	coinbasepro "github.com/preichenberger/go-coinbasepro"
+)
+
+const (
+	COINBASE_PRO_WS_URI = "wss://ws-feed.pro.coinbase.com"
+
+	FEED_CONNECTING   = "connecting"
+	FEED_CONNECTED    = "connected"
+	FEED_DISCONNECTED = "disconnected"
+)
+
+var (
+	// The feed is considered dead when nothing, not even a heartbeat, arrives
+	// for COINBASE_PRO_STALE_AFTER.
+	COINBASE_PRO_STALE_AFTER  = 15 * time.Second
+	COINBASE_PRO_DIAL_TIMEOUT = 10 * time.Second
+	COINBASE_PRO_MIN_BACKOFF  = 1 * time.Second
+	COINBASE_PRO_MAX_BACKOFF  = 1 * time.Minute
+)
+
+// FeedState describes the Coinbase Pro websocket connection, it is guarded
+// by the mux of the Server.
+type FeedState struct {
+	Status      string    `json:"status"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastMessage time.Time `json:"lastMessage"`
+	Reconnects  int       `json:"reconnects"`
+	LastError   string    `json:"lastError"`
+}
+
+func (s FeedState) String() string {
+	switch s.Status {
+	case FEED_CONNECTED:
+		return fmt.Sprintf("%s since %s", s.Status, s.ConnectedAt.Format("15:04:05"))
+	case FEED_DISCONNECTED:
+		return fmt.Sprintf("%s (%s), %d reconnects", s.Status, s.LastError, s.Reconnects)
+	}
+	return s.Status
+}
+
+// startCoinbaseProWS keeps the Coinbase Pro feed connected until ctx is
+// done, reconnecting with an exponential backoff whenever the connection
+// fails or goes stale.
+func (s *Server) startCoinbaseProWS(ctx context.Context) {
+	backoff := COINBASE_PRO_MIN_BACKOFF
+	for {
+		start := time.Now()
+		err := s.runCoinbaseProWS(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mux.Lock()
+		s.coinbaseProState.Status = FEED_DISCONNECTED
+		s.coinbaseProState.LastError = err.Error()
+		s.coinbaseProState.Reconnects++
+		s.mux.Unlock()
+		fmt.Println("Coinbase Pro feed disconnected : ", err)
+		log.Println("Coinbase Pro feed disconnected : ", err)
+
+		// A connection that stayed up for a while starts the backoff over.
+		if time.Since(start) > COINBASE_PRO_MAX_BACKOFF {
+			backoff = COINBASE_PRO_MIN_BACKOFF
+		}
+		if !sleep(ctx, backoff) {
+			return
+		}
+		backoff *= 2
+		if backoff > COINBASE_PRO_MAX_BACKOFF {
+			backoff = COINBASE_PRO_MAX_BACKOFF
+		}
+	}
+}
+
+// runCoinbaseProWS connects, subscribes to the ticker and heartbeat channels
+// of the reference products and reads until the connection fails or ctx is
+// done.
+func (s *Server) runCoinbaseProWS(ctx context.Context) error {
+	s.mux.Lock()
+	s.coinbaseProState.Status = FEED_CONNECTING
+	s.mux.Unlock()
+
+	dialCtx, cancel := context.WithTimeout(ctx, COINBASE_PRO_DIAL_TIMEOUT)
+	wsConn, _, err := wsDialer.DialContext(dialCtx, COINBASE_PRO_WS_URI, nil)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Coinbase Pro : %s", err)
+	}
+	defer wsConn.Close()
+
+	// Closing the connection ends the blocked read below.
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-ctx.Done():
+			wsConn.Close()
+		case <-closed:
+		}
+	}()
+
+	// Reloads change the subscription of coinbaseProConn, hold them off until
+	// it is set.
+	s.reloadMux.Lock()
+	products := coinbaseProProducts(s.currentConfig())
+
+	if err := wsConn.WriteJSON(coinbaseProSubscription("subscribe", products)); err != nil {
+		s.reloadMux.Unlock()
+		return fmt.Errorf("failed to subscribe to Coinbase Pro : %s", err)
+	}
+
+	now := time.Now()
+	s.mux.Lock()
+	s.coinbaseProConn = wsConn
+	s.coinbaseProState.Status = FEED_CONNECTED
+	s.coinbaseProState.ConnectedAt = now
+	s.coinbaseProState.LastMessage = now
+	s.mux.Unlock()
+	s.reloadMux.Unlock()
+
+	defer func() {
+		s.mux.Lock()
+		s.coinbaseProConn = nil
+		s.mux.Unlock()
+	}()
+
+	for {
+		wsConn.SetReadDeadline(time.Now().Add(COINBASE_PRO_STALE_AFTER))
+
+		message := coinbasepro.Message{}
+		if err := wsConn.ReadJSON(&message); err != nil {
+			return fmt.Errorf("failed to read Coinbase Pro messages : %s", err)
+		}
+
+		s.mux.Lock()
+		s.coinbaseProState.LastMessage = time.Now()
+		s.mux.Unlock()
+
+		switch message.Type {
+		case "error":
+			return fmt.Errorf("Coinbase Pro returned an error : %s", message.Message)
+		case "ticker":
+			s.setCoinbaseProPrice(message)
+		}
+	}
+}
+
+func (s *Server) setCoinbaseProPrice(message coinbasepro.Message) {
+	id := message.ProductID
+	if !strings.HasSuffix(id, "-USD") {
+		return
+	}
+	id = id[0 : len(id)-4]
+
+	pAsk, _ := strconv.ParseFloat(message.BestAsk, 64)
+	pBid, _ := strconv.ParseFloat(message.BestBid, 64)
+
+	now := s.clock.Now()
+
+	// Every tick copies only the three maps it changes.
+	s.store.UpdateShallow(func(next *MarketState) {
+		next.Spreads = copyFloats(next.Spreads)
+		next.QuoteTimes = copyTimes(next.QuoteTimes)
+		next.CoinbaseProPrices = copyPrices(next.CoinbaseProPrices)
+
+		next.Spreads[GDAX+id] = (pAsk - pBid) * 100 / pBid
+		next.QuoteTimes[GDAX+"-"+id] = now
+
+		p, ok := next.CoinbaseProPrices[id]
+		if !ok {
+			p = Price{Exchange: GDAX, Currency: "USD", ID: id}
+		}
+		p.Ask = pAsk
+		p.Bid = pBid
+		p.ExchangeTime = message.Time.Time()
+		p.ReceivedAt = now
+		next.CoinbaseProPrices[id] = p
+	})
+}
+
+func coinbaseProSubscription(messageType string, products []string) coinbasepro.Message {
+	return coinbasepro.Message{
+		Type: messageType,
+		Channels: []coinbasepro.MessageChannel{
+			coinbasepro.MessageChannel{Name: "ticker", ProductIds: products},
+			coinbasepro.MessageChannel{Name: "heartbeat", ProductIds: products},
+		},
+	}
+}
+
+// updateCoinbaseProSubscription changes the products of the open Coinbase Pro
+// feed. Before the feed is connected there is nothing to do, the next
+// connection subscribes to the current products anyway. A failed write
+// closes the connection so the reconnect picks up the new products.
+func (s *Server) updateCoinbaseProSubscription(removed, added []string) {
+	s.mux.Lock()
+	wsConn := s.coinbaseProConn
+	s.mux.Unlock()
+	if wsConn == nil {
+		return
+	}
+
+	for _, change := range []struct {
+		messageType string
+		products    []string
+	}{{"unsubscribe", removed}, {"subscribe", added}} {
+		if len(change.products) == 0 {
+			continue
+		}
+
+		if err := wsConn.WriteJSON(coinbaseProSubscription(change.messageType, change.products)); err != nil {
+			fmt.Println("Failed to update the Coinbase Pro subscription : ", err)
+			log.Println("Failed to update the Coinbase Pro subscription : ", err)
+			wsConn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,798 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	DEFAULT_CONFIG_FILE = "config.yml"
+)
+
+type ExchangeConfig struct {
+	Enabled *bool    `yaml:"enabled"`
+	Symbols []string `yaml:"symbols"`
+	// Currency changes the quote currency of the exchange, the pairs are
+	// requested in it.
+	Currency string `yaml:"currency"`
+	// Interval defaults to intervals.prices. RequestsPerSecond and Burst size
+	// the request budget, Concurrency limits the parallel per-symbol
+	// requests.
+	Interval          time.Duration `yaml:"interval"`
+	RequestsPerSecond float64       `yaml:"requestsPerSecond"`
+	Burst             int           `yaml:"burst"`
+	Concurrency       int           `yaml:"concurrency"`
+}
+
+type ReferenceConfig struct {
+	CoinbasePro []string `yaml:"coinbasePro"`
+	Binance     []string `yaml:"binance"`
+	Bittrex     []string `yaml:"bittrex"`
+}
+
+type NotificationConfig struct {
+	Exchanges []string `yaml:"exchanges"`
+	// GlobalExcludes are the exchanges of Exchanges left out of the fiat
+	// thresholds, their pair and triangle alerts are still sent.
+	GlobalExcludes []string `yaml:"globalExcludes"`
+	FiatEnabled    bool     `yaml:"fiatEnabled"`
+	Minimum        float64  `yaml:"minimum"`
+	Maximum        float64  `yaml:"maximum"`
+	PairEnabled    bool     `yaml:"pairEnabled"`
+	PairThreshold  float64  `yaml:"pairThreshold"`
+	// Triangle is the cycle return, in percent after fees, above which a
+	// triangular arbitrage is notified.
+	Triangle float64 `yaml:"triangle"`
+	// Duration is the cooldown between two notifications of the same pair,
+	// in minutes.
+	Duration float64 `yaml:"duration"`
+	// Channels lists the notifiers of every alert, the alerts that are not
+	// listed use the "default" ones. Without channels every notifier gets
+	// every alert.
+	Channels map[string][]string `yaml:"channels"`
+}
+
+type IntervalConfig struct {
+	Prices     time.Duration `yaml:"prices"`
+	Diffs      time.Duration `yaml:"diffs"`
+	Currencies time.Duration `yaml:"currencies"`
+	Depth      time.Duration `yaml:"depth"`
+}
+
+// HTTPConfig applies to the exchange and rate requests. Timeouts are keyed
+// by exchange or rate source name and override Timeout. Retries is the number
+// of retries after the first attempt.
+type HTTPConfig struct {
+	Timeout      time.Duration            `yaml:"timeout"`
+	Timeouts     map[string]time.Duration `yaml:"timeouts"`
+	Retries      int                      `yaml:"retries"`
+	MaxBodyBytes int64                    `yaml:"maxBodyBytes"`
+}
+
+type FxCurrencyConfig struct {
+	// Providers are asked in this order, the fallback strategy uses the first
+	// one that answers.
+	Providers []string `yaml:"providers"`
+	Strategy  string   `yaml:"strategy"`
+	// Interval defaults to intervals.currencies when it is not set.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type FxConfig struct {
+	DivergencePercent float64                     `yaml:"divergencePercent"`
+	Currencies        map[string]FxCurrencyConfig `yaml:"currencies"`
+	// ReferenceMode selects the rate the reference prices are converted with,
+	// "interbank" or "stablecoin" for the rate implied by Stablecoins.
+	ReferenceMode  string   `yaml:"referenceMode"`
+	Stablecoins    []string `yaml:"stablecoins"`
+	CompareSymbols []string `yaml:"compareSymbols"`
+}
+
+// NotifierConfig is a notification channel. User and Token are the Pushover
+// user and app token, Token is the bot token for Telegram. URL is the Slack
+// or webhook address and overrides the Pushover and Telegram API.
+type NotifierConfig struct {
+	Type     string   `yaml:"type"`
+	URL      string   `yaml:"url"`
+	User     string   `yaml:"user"`
+	Token    string   `yaml:"token"`
+	ChatID   string   `yaml:"chatId"`
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+type CredentialConfig struct {
+	AlphaVantageKey  string `yaml:"alphaVantageKey"`
+	PushoverUser     string `yaml:"pushoverUser"`
+	PushoverAppToken string `yaml:"pushoverAppToken"`
+	// AdminToken protects the admin endpoints, they are disabled when empty.
+	AdminToken string `yaml:"adminToken"`
+}
+
+// Config is read from a YAML file at startup. Exchanges are keyed by their
+// name, an exchange missing from the map is enabled with its built-in
+// symbols.
+type Config struct {
+	Symbols      []string                  `yaml:"symbols"`
+	References   ReferenceConfig           `yaml:"references"`
+	Exchanges    map[string]ExchangeConfig `yaml:"exchanges"`
+	Notification NotificationConfig        `yaml:"notification"`
+	Intervals    IntervalConfig            `yaml:"intervals"`
+	HTTP         HTTPConfig                `yaml:"http"`
+	FX           FxConfig                  `yaml:"fx"`
+	Credentials  CredentialConfig          `yaml:"credentials"`
+	HistoryDir   string                    `yaml:"historyDir"`
+	RulesFile    string                    `yaml:"rulesFile"`
+	// Notifiers are keyed by the name the channels refer to. The Pushover
+	// credentials add a "pushover" notifier when it is not configured.
+	Notifiers map[string]NotifierConfig `yaml:"notifiers"`
+	// MaxQuoteAge is keyed by exchange name, "default" applies to the
+	// exchanges that are not listed.
+	MaxQuoteAge map[string]time.Duration `yaml:"maxQuoteAge"`
+	// Fees are keyed by exchange name, every enabled exchange and reference
+	// needs a schedule. The fees of a config file replace the built-in ones
+	// as a whole, the built-in ones only apply without a config file.
+	Fees map[string]FeeSchedule `yaml:"fees"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Symbols: []string{"BTC", "ETH", "LTC", "BCH", "ETC", "ZRX", "XRP", "XLM", "EOS", "USDT", "DOGE", "XEM", "LINK", "DASH"},
+		References: ReferenceConfig{
+			CoinbasePro: []string{"BTC", "BCH", "ETH", "LTC", "ETC", "ZRX", "XRP", "XLM", "EOS", "LINK", "DASH"},
+			Binance:     []string{"USDT", "DOGE", "XEM"},
+			Bittrex:     []string{"USDT", "DOGE", "XRP", "XLM", "XEM"},
+		},
+		Exchanges: map[string]ExchangeConfig{},
+		Notification: NotificationConfig{
+			Exchanges:      []string{PARIBU, BTCTURK, KOINEKS, KOINIM, VEBITCOIN},
+			GlobalExcludes: []string{PARIBU, BTCTURK},
+			FiatEnabled:    true,
+			Minimum:        -2.0,
+			Maximum:        3.25,
+			PairEnabled:    true,
+			PairThreshold:  1.0,
+			Triangle:       0.5,
+			Duration:       10.0,
+		},
+		HTTP: HTTPConfig{
+			Timeout:      10 * time.Second,
+			Timeouts:     map[string]time.Duration{},
+			Retries:      2,
+			MaxBodyBytes: 5 << 20,
+		},
+		Intervals: IntervalConfig{
+			Prices:     2 * time.Second,
+			Diffs:      1 * time.Second,
+			Currencies: 1 * time.Hour,
+			Depth:      10 * time.Second,
+		},
+		FX: FxConfig{
+			DivergencePercent: 2.5,
+			Currencies: map[string]FxCurrencyConfig{
+				"TRY": {Providers: []string{ALPHAVANTAGE, CENTRAL_BANK, IMPLIED}, Strategy: FX_FALLBACK},
+				"AED": {Providers: []string{ALPHAVANTAGE, CENTRAL_BANK}, Strategy: FX_FALLBACK},
+			},
+			ReferenceMode:  REFERENCE_INTERBANK,
+			Stablecoins:    []string{"USDT"},
+			CompareSymbols: []string{"BTC", "ETH"},
+		},
+		HistoryDir: "history",
+		RulesFile:  "rules.json",
+		MaxQuoteAge: map[string]time.Duration{
+			"default": 30 * time.Second,
+			// Coinbase Pro only sends a ticker on trades.
+			GDAX: 5 * time.Minute,
+		},
+		Fees: defaultFeeSchedules(),
+	}
+}
+
+// DefaultConfig returns the built-in settings, a starting point for the
+// config of an embedded Server.
+func DefaultConfig() *Config {
+	return defaultConfig()
+}
+
+// LoadConfig reads the YAML file at path on top of the defaults, applies the
+// environment overrides and validates it against the registered exchanges. A
+// missing file is not an error.
+func LoadConfig(path string) (*Config, error) {
+	cfg, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(newExchanges(venue{}), nil); err != nil {
+		return nil, fmt.Errorf("invalid config %s : %s", path, err)
+	}
+	return cfg, nil
+}
+
+// readConfig is LoadConfig without the validation, a Server validates the
+// config against its own exchanges and notifiers.
+func readConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the config file %s : %s", path, err)
+	}
+	if err == nil {
+		// yaml merges maps into the defaults, an exchange missing from the
+		// fees of the file would keep its built-in schedule.
+		cfg.Fees = nil
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse the config file %s : %s", path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) applyEnv() error {
+	stringVars := map[string]*string{
+		"ALPHAVANTAGE_API_KEY": &cfg.Credentials.AlphaVantageKey,
+		"PUSHOVER_USER":        &cfg.Credentials.PushoverUser,
+		"PUSHOVER_APP_TOKEN":   &cfg.Credentials.PushoverAppToken,
+		"ADMIN_TOKEN":          &cfg.Credentials.AdminToken,
+		"HISTORY_DIR":          &cfg.HistoryDir,
+		"RULES_FILE":           &cfg.RulesFile,
+	}
+	for name, field := range stringVars {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+
+	floatVars := map[string]*float64{
+		"MIN_NOTI_PERC":      &cfg.Notification.Minimum,
+		"MAX_NOTI_PERC":      &cfg.Notification.Maximum,
+		"PAIR_THRESHOLD":     &cfg.Notification.PairThreshold,
+		"TRIANGLE_NOTI_PERC": &cfg.Notification.Triangle,
+		"NOTI_DURATION":      &cfg.Notification.Duration,
+	}
+	for name, field := range floatVars {
+		if value := os.Getenv(name); value != "" {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s : %s", name, err)
+			}
+			*field = f
+		}
+	}
+
+	durationVars := map[string]*time.Duration{
+		"PRICE_INTERVAL":    &cfg.Intervals.Prices,
+		"DIFF_INTERVAL":     &cfg.Intervals.Diffs,
+		"CURRENCY_INTERVAL": &cfg.Intervals.Currencies,
+		"DEPTH_INTERVAL":    &cfg.Intervals.Depth,
+	}
+	for name, field := range durationVars {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s : %s", name, err)
+			}
+			*field = d
+		}
+	}
+	return nil
+}
+
+// validate checks cfg against the exchanges it can configure and the notifiers
+// given next to it.
+func (cfg *Config) validate(exchanges []Exchange, notifiers map[string]Notifier) error {
+	if len(cfg.Symbols) == 0 {
+		return fmt.Errorf("no symbols are configured")
+	}
+
+	symbols := map[string]bool{}
+	for _, symbol := range cfg.Symbols {
+		if symbols[symbol] {
+			return fmt.Errorf("symbol %s is listed twice", symbol)
+		}
+		symbols[symbol] = true
+	}
+
+	referenced := map[string]bool{}
+	for _, list := range [][]string{cfg.References.CoinbasePro, cfg.References.Binance} {
+		for _, symbol := range list {
+			if !symbols[symbol] {
+				return fmt.Errorf("reference symbol %s is not in the symbol list", symbol)
+			}
+			referenced[symbol] = true
+		}
+	}
+	for _, symbol := range cfg.Symbols {
+		if !referenced[symbol] {
+			return fmt.Errorf("symbol %s has no reference exchange", symbol)
+		}
+	}
+
+	for name, e := range cfg.Exchanges {
+		if findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown exchange %s", name)
+		}
+		for _, symbol := range e.Symbols {
+			if !symbols[symbol] {
+				return fmt.Errorf("symbol %s of %s is not in the symbol list", symbol, name)
+			}
+		}
+
+		if e.Interval < 0 || e.RequestsPerSecond < 0 || e.Burst < 0 || e.Concurrency < 0 {
+			return fmt.Errorf("the schedule of %s cannot be negative", name)
+		}
+
+		if e.Currency != "" && !isCurrencyCode(e.Currency) {
+			return fmt.Errorf("invalid currency %q of %s", e.Currency, name)
+		}
+	}
+
+	for _, name := range cfg.Notification.Exchanges {
+		if findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown notification exchange %s", name)
+		}
+	}
+	for _, name := range cfg.Notification.GlobalExcludes {
+		if findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown excluded notification exchange %s", name)
+		}
+	}
+
+	if cfg.Notification.Minimum >= cfg.Notification.Maximum {
+		return fmt.Errorf("notification minimum %.2f must be below the maximum %.2f", cfg.Notification.Minimum, cfg.Notification.Maximum)
+	}
+	if cfg.Notification.Duration < 0 {
+		return fmt.Errorf("notification duration cannot be negative")
+	}
+
+	for name, n := range cfg.Notifiers {
+		if _, err := newNotifier(n, nil); err != nil {
+			return fmt.Errorf("notifier %s : %s", name, err)
+		}
+	}
+	for alert, channels := range cfg.Notification.Channels {
+		if !containsSymbol(ALERTS, alert) {
+			return fmt.Errorf("unknown alert %s in the notification channels", alert)
+		}
+		for _, name := range channels {
+			if _, ok := cfg.Notifiers[name]; !ok && notifiers[name] == nil && name != NOTIFIER_PUSHOVER {
+				return fmt.Errorf("unknown notifier %s for the %s alert", name, alert)
+			}
+		}
+	}
+
+	intervals := map[string]time.Duration{
+		"prices":     cfg.Intervals.Prices,
+		"diffs":      cfg.Intervals.Diffs,
+		"currencies": cfg.Intervals.Currencies,
+		"depth":      cfg.Intervals.Depth,
+	}
+	for name, interval := range intervals {
+		if interval <= 0 {
+			return fmt.Errorf("%s interval must be positive", name)
+		}
+	}
+
+	if cfg.FX.DivergencePercent <= 0 {
+		return fmt.Errorf("fx divergence percent must be positive")
+	}
+	for currency, fxConfig := range cfg.FX.Currencies {
+		if len(fxConfig.Providers) == 0 {
+			return fmt.Errorf("no fx providers are configured for %s", currency)
+		}
+		for _, name := range fxConfig.Providers {
+			if !containsSymbol(FX_PROVIDERS, name) {
+				return fmt.Errorf("unknown fx provider %s for %s", name, currency)
+			}
+		}
+		if fxConfig.Strategy != FX_MEDIAN && fxConfig.Strategy != FX_FALLBACK {
+			return fmt.Errorf("unknown fx strategy %s for %s", fxConfig.Strategy, currency)
+		}
+		if fxConfig.Interval < 0 {
+			return fmt.Errorf("fx interval of %s cannot be negative", currency)
+		}
+	}
+
+	if cfg.FX.ReferenceMode != REFERENCE_INTERBANK && cfg.FX.ReferenceMode != REFERENCE_STABLECOIN {
+		return fmt.Errorf("unknown reference mode %s", cfg.FX.ReferenceMode)
+	}
+	for _, list := range [][]string{cfg.FX.Stablecoins, cfg.FX.CompareSymbols} {
+		for _, symbol := range list {
+			if !symbols[symbol] {
+				return fmt.Errorf("fx symbol %s is not in the symbol list", symbol)
+			}
+		}
+	}
+
+	if cfg.HTTP.Timeout <= 0 {
+		return fmt.Errorf("http timeout must be positive")
+	}
+	for name, timeout := range cfg.HTTP.Timeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("http timeout of %s must be positive", name)
+		}
+	}
+	if cfg.HTTP.Retries < 0 {
+		return fmt.Errorf("http retries cannot be negative")
+	}
+	if cfg.HTTP.MaxBodyBytes <= 0 {
+		return fmt.Errorf("http max body bytes must be positive")
+	}
+
+	if cfg.HistoryDir == "" {
+		return fmt.Errorf("history directory is not configured")
+	}
+	if cfg.RulesFile == "" {
+		return fmt.Errorf("rules file is not configured")
+	}
+
+	for name, fees := range cfg.Fees {
+		if name != GDAX && name != BINANCE && findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown exchange %s in the fees", name)
+		}
+		if err := fees.validate(); err != nil {
+			return fmt.Errorf("fees of %s : %s", name, err)
+		}
+	}
+	var needFees []string
+	if len(cfg.References.CoinbasePro) > 0 {
+		needFees = append(needFees, GDAX)
+	}
+	if len(cfg.References.Binance) > 0 {
+		needFees = append(needFees, BINANCE)
+	}
+	for _, e := range exchanges {
+		if c, ok := cfg.Exchanges[e.Name()]; !ok || c.Enabled == nil || *c.Enabled {
+			needFees = append(needFees, e.Name())
+		}
+	}
+	for _, name := range needFees {
+		if _, ok := cfg.Fees[name]; !ok {
+			return fmt.Errorf("no fees are configured for %s", name)
+		}
+	}
+
+	if _, ok := cfg.MaxQuoteAge["default"]; !ok {
+		return fmt.Errorf("no default max quote age is configured")
+	}
+	for name, age := range cfg.MaxQuoteAge {
+		if name != "default" && name != GDAX && name != BINANCE && findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown exchange %s in the max quote ages", name)
+		}
+		if age <= 0 {
+			return fmt.Errorf("max quote age of %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// Settings is one version of the config in effect, with the limits changed
+// on the notification page, and of the notifiers built from it. A published
+// Settings is never modified, so it is read without a lock; the loops take
+// it once per cycle and a reload never changes it halfway.
+type Settings struct {
+	Config *Config
+	// Notifiers are keyed by their configured name, Channels lists the
+	// notifiers of every alert.
+	Notifiers map[string]Notifier
+	Channels  map[string][]string
+}
+
+// newSettings builds the notifiers of cfg, which post through the HTTP client
+// of the server, next to the injected ones.
+func (s *Server) newSettings(cfg *Config) *Settings {
+	set := &Settings{Config: cfg, Notifiers: map[string]Notifier{}}
+	client := s.httpClient.client
+
+	var names []string
+	for name, n := range cfg.Notifiers {
+		set.Notifiers[name], _ = newNotifier(n, client)
+		names = append(names, name)
+	}
+	if _, ok := cfg.Notifiers[NOTIFIER_PUSHOVER]; !ok && cfg.Credentials.PushoverUser != "" && cfg.Credentials.PushoverAppToken != "" {
+		set.Notifiers[NOTIFIER_PUSHOVER] = pushoverNotifier{client: client, uri: PUSHOVER_URI, user: cfg.Credentials.PushoverUser, token: cfg.Credentials.PushoverAppToken}
+		names = append(names, NOTIFIER_PUSHOVER)
+	}
+	for name, n := range s.notifiers {
+		set.Notifiers[name] = n
+		names = append(names, name)
+	}
+
+	set.Channels = cfg.Notification.Channels
+	if len(set.Channels) == 0 {
+		sort.Strings(names)
+		set.Channels = map[string][]string{ALERT_DEFAULT: names}
+	}
+	return set
+}
+
+// settingsStore publishes the settings the way MarketStore publishes the
+// market states.
+type settingsStore struct {
+	// mu serializes the writers, the readers never wait on it.
+	mu      sync.Mutex
+	current atomic.Value
+}
+
+func newSettingsStore(set *Settings) *settingsStore {
+	s := &settingsStore{}
+	s.current.Store(set)
+	return s
+}
+
+// Snapshot returns the current settings, which must not be modified.
+func (s *settingsStore) Snapshot() *Settings {
+	return s.current.Load().(*Settings)
+}
+
+// Update calls fn with a copy of the current settings and of their config
+// and publishes it. fn may replace the fields and change the config fields
+// that are not maps or slices, the others are shared with the previous
+// version.
+func (s *settingsStore) Update(fn func(next *Settings)) *Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := *s.Snapshot()
+	cfg := *next.Config
+	next.Config = &cfg
+	fn(&next)
+	s.current.Store(&next)
+	return &next
+}
+
+// applyConfig publishes the settings of cfg, the loops pick them up on their
+// next cycle.
+func (s *Server) applyConfig(cfg *Config) {
+	set := s.newSettings(cfg)
+	s.settings.Update(func(next *Settings) {
+		*next = *set
+	})
+	s.initReferencePrices(cfg)
+}
+
+// coinbaseProProducts returns the Coinbase Pro products of the reference
+// symbols.
+func coinbaseProProducts(cfg *Config) []string {
+	var products []string
+	for _, symbol := range cfg.References.CoinbasePro {
+		products = append(products, symbol+"-USD")
+	}
+	return products
+}
+
+// loadConfig reads the config file, or takes the config given with
+// WithConfig, and validates it against the exchanges and notifiers of s.
+func (s *Server) loadConfig() (*Config, error) {
+	var cfg *Config
+	if s.config != nil {
+		// The applied config is published, a reload must not change it.
+		copied := *s.config
+		cfg = &copied
+	} else {
+		var err error
+		if cfg, err = readConfig(s.configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.validate(s.exchanges, s.notifiers); err != nil {
+		return nil, fmt.Errorf("invalid config %s : %s", s.configSource(), err)
+	}
+	return cfg, nil
+}
+
+// configSource names where the config comes from.
+func (s *Server) configSource() string {
+	if s.config != nil {
+		return "given to the server"
+	}
+	return s.configFile
+}
+
+// ReloadConfig reads the config file again, or applies the config given with
+// WithConfig again, and swaps it in while the loops keep running. Notification
+// cooldowns are kept, and the Coinbase Pro feed changes its subscription on
+// the open connection. The history directory is only read at startup.
+func (s *Server) ReloadConfig() error {
+	s.reloadMux.Lock()
+	defer s.reloadMux.Unlock()
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if old := s.currentConfig(); old.HistoryDir != cfg.HistoryDir {
+		fmt.Println("The history directory change needs a restart, keeping ", old.HistoryDir)
+		log.Println("The history directory change needs a restart, keeping ", old.HistoryDir)
+		cfg.HistoryDir = old.HistoryDir
+	}
+	if old := s.currentConfig(); old.RulesFile != cfg.RulesFile {
+		fmt.Println("The rules file change needs a restart, keeping ", old.RulesFile)
+		log.Println("The rules file change needs a restart, keeping ", old.RulesFile)
+		cfg.RulesFile = old.RulesFile
+	}
+
+	oldProducts := coinbaseProProducts(s.currentConfig())
+	s.applyConfig(cfg)
+	newProducts := coinbaseProProducts(cfg)
+
+	s.updateCoinbaseProSubscription(missingSymbols(oldProducts, newProducts), missingSymbols(newProducts, oldProducts))
+	s.checkRules()
+
+	log.Println("Reloaded the config ", s.configSource())
+	return nil
+}
+
+// watchConfigReloads reloads the config on every SIGHUP.
+func (s *Server) watchConfigReloads(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+
+		if err := s.ReloadConfig(); err != nil {
+			fmt.Println("Failed to reload the config : ", err)
+			log.Println("Failed to reload the config : ", err)
+		}
+	}
+}
+
+// ReloadConfigHandler reloads the config for requests carrying the admin
+// token as a bearer token.
+func (s *Server) ReloadConfigHandler(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	if err := s.ReloadConfig(); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "config": s.configSource()})
+}
+
+// authorizeAdmin checks the bearer token of an admin request and answers it
+// when the token is missing or wrong.
+func (s *Server) authorizeAdmin(c *gin.Context) bool {
+	token := s.currentConfig().Credentials.AdminToken
+	if token == "" {
+		c.String(http.StatusNotFound, "the admin endpoints are disabled")
+		return false
+	}
+
+	given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		c.String(http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// isCurrencyCode tells if code looks like an ISO 4217 currency code.
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// missingSymbols returns the entries of list that are not in other.
+func missingSymbols(list, other []string) []string {
+	var missing []string
+	for _, symbol := range list {
+		if !containsSymbol(other, symbol) {
+			missing = append(missing, symbol)
+		}
+	}
+	return missing
+}
+
+// currentConfig returns the config of the current settings. The request
+// handlers read it once per request and the loops once per cycle, the
+// helpers they call are given that config so a reload never mixes in.
+func (s *Server) currentConfig() *Config {
+	return s.settings.Snapshot().Config
+}
+
+// activeExchanges returns the exchanges of s that are not disabled in cfg.
+func (s *Server) activeExchanges(cfg *Config) []Exchange {
+	var list []Exchange
+	for _, e := range s.exchanges {
+		if c, ok := cfg.Exchanges[e.Name()]; ok && c.Enabled != nil && !*c.Enabled {
+			continue
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// findActiveExchange returns the exchange if s has it and it is enabled in
+// cfg.
+func (s *Server) findActiveExchange(cfg *Config, name string) Exchange {
+	return findExchange(s.activeExchanges(cfg), name)
+}
+
+// exchangeInterval returns how often the exchange is polled.
+func exchangeInterval(cfg *Config, name string) time.Duration {
+	if cfg.Exchanges[name].Interval > 0 {
+		return cfg.Exchanges[name].Interval
+	}
+	return cfg.Intervals.Prices
+}
+
+// exchangeBudget returns the request rate and burst of an exchange or a rate
+// source.
+func exchangeBudget(cfg *Config, name string) (float64, int) {
+	rate, burst := DEFAULT_REQUESTS_PER_SECOND, DEFAULT_BURST
+	e := cfg.Exchanges[name]
+	if e.RequestsPerSecond > 0 {
+		rate = e.RequestsPerSecond
+	}
+	if e.Burst > 0 {
+		burst = e.Burst
+	}
+	return rate, burst
+}
+
+func exchangeConcurrency(cfg *Config, name string) int {
+	if e := cfg.Exchanges[name]; e.Concurrency > 0 {
+		return e.Concurrency
+	}
+	return DEFAULT_CONCURRENCY
+}
+
+// maxQuoteAge returns how old a quote of the exchange may get before it is
+// left out of the diffs.
+func maxQuoteAge(cfg *Config, name string) time.Duration {
+	if age, ok := cfg.MaxQuoteAge[name]; ok {
+		return age
+	}
+	return cfg.MaxQuoteAge["default"]
+}
+
+func findExchange(list []Exchange, name string) Exchange {
+	for _, e := range list {
+		if e.Name() == name {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFeesReplaceTheDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	data := "fees:\n  Paribu: {makerPercent: 0.25, takerPercent: 0.35}\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Fees) != 1 {
+		t.Errorf("got the fees of %d exchanges, want the one of the file", len(cfg.Fees))
+	}
+
+	_, err = LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "no fees are configured for") {
+		t.Errorf("error is %v, want missing fees", err)
+	}
+}
+
+func TestConfigWithoutFileKeepsTheDefaultFees(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Fees) != len(defaultFeeSchedules()) {
+		t.Errorf("got the fees of %d exchanges, want %d", len(cfg.Fees), len(defaultFeeSchedules()))
+	}
+}
+
+func TestGlobalRulesSkipTheExcludedExchanges(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Notification.GlobalExcludes = []string{KOINIM}
+
+	rules := globalRules(cfg)
+	if len(rules) != 2 {
+		t.Fatalf("got %d global rules, want 2", len(rules))
+	}
+	for _, r := range rules {
+		if containsSymbol(r.Exchanges, KOINIM) || !containsSymbol(r.Exchanges, PARIBU) {
+			t.Errorf("rule %s covers %v", r.ID, r.Exchanges)
+		}
+	}
+}
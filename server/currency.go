@@ -1,71 +1,246 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"strconv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+)
+
+const (
+	FX_MEDIAN   = "median"
+	FX_FALLBACK = "fallback"
 
-	"github.com/buger/jsonparser"
+	REFERENCE_INTERBANK  = "interbank"
+	REFERENCE_STABLECOIN = "stablecoin"
 )
 
 var (
-	tryRate = 0.0
-	aedRate = 0.0
+	FX_TIMEOUT        = 10 * time.Second
+	FX_CHECK_INTERVAL = 5 * time.Second
+	FX_RETRY_INTERVAL = 1 * time.Minute
+
+	// Used for the currencies a venue quotes in but the config does not list.
+	DEFAULT_FX_CURRENCY = FxCurrencyConfig{Providers: []string{ALPHAVANTAGE, CENTRAL_BANK, IMPLIED}, Strategy: FX_FALLBACK}
 )
 
-func getCurrencies() {
+// FxSourceRate is the last answer of one provider for a currency.
+type FxSourceRate struct {
+	Provider string  `json:"provider"`
+	Rate     float64 `json:"rate,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// fxRate is a conversion rate shown on the dashboard.
+type fxRate struct {
+	Currency string
+	Rate     float64
+	Implied  float64
+}
+
+// usdRate returns how many units of a quote currency one USD buys, 0 until
+// it is known. It must be called with mux held.
+func (s *Server) usdRate(currency string) float64 {
+	if currency == "USD" {
+		return 1
+	}
+	return s.usdRates[currency]
+}
+
+// referenceRate is the rate the reference prices are converted with. In the
+// stablecoin mode it is the implied rate when the currency has one. It must
+// be called with mux held.
+func (s *Server) referenceRate(cfg *Config, currency string) float64 {
+	if cfg.FX.ReferenceMode == REFERENCE_STABLECOIN && s.impliedRates[currency] > 0 {
+		return s.impliedRates[currency]
+	}
+	return s.usdRate(currency)
+}
+
+// updateImpliedRates derives the rates from the quotes of m. It must be
+// called with mux held.
+func (s *Server) updateImpliedRates(m *MarketState, cfg *Config, now time.Time) {
+	s.impliedRates = map[string]float64{}
+	for _, e := range s.activeExchanges(cfg) {
+		currency := e.Currency()
+		if _, ok := s.impliedRates[currency]; ok || currency == "USD" {
+			continue
+		}
+
+		if rate, err := s.impliedUSDRate(m, cfg, currency, now); err == nil {
+			s.impliedRates[currency] = rate
+		}
+	}
+}
+
+// setUSDRate must be called with mux held.
+func (s *Server) setUSDRate(currency string, rate float64) {
+	s.usdRates[currency] = rate
+	s.rateTimes[currency] = s.clock.Now()
+}
+
+// fxRates lists the rates of the configured currencies and of the ones the
+// venues quote in. It must be called with mux held.
+func (s *Server) fxRates(cfg *Config) []fxRate {
+	var rates []fxRate
+	for _, currency := range s.fxCurrencies(cfg) {
+		rates = append(rates, fxRate{Currency: currency, Rate: s.usdRate(currency), Implied: s.impliedRates[currency]})
+	}
+	return rates
+}
+
+// fxCurrencies returns the sorted currencies that need a USD rate.
+func (s *Server) fxCurrencies(cfg *Config) []string {
+	var currencies []string
+	for currency := range s.fxCurrencyConfigs(cfg) {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// fxCurrencyConfigs returns the FX settings of the configured currencies and
+// of the ones the venues quote in, the latter with DEFAULT_FX_CURRENCY unless
+// they are configured.
+func (s *Server) fxCurrencyConfigs(cfg *Config) map[string]FxCurrencyConfig {
+	configs := map[string]FxCurrencyConfig{}
+	for currency, fxConfig := range cfg.FX.Currencies {
+		configs[currency] = fxConfig
+	}
+
+	for _, e := range s.activeExchanges(cfg) {
+		if _, ok := configs[e.Currency()]; !ok && e.Currency() != "USD" {
+			configs[e.Currency()] = DEFAULT_FX_CURRENCY
+		}
+	}
+	return configs
+}
+
+// getCurrencies refreshes every currency once its interval has passed. A
+// currency nobody answered for is retried sooner.
+func (s *Server) getCurrencies(ctx context.Context) {
 	for {
-		getCurrencyRates()
-		time.Sleep(1 * time.Hour)
+		set := s.settings.Snapshot()
+		for currency, fxConfig := range s.fxCurrencyConfigs(set.Config) {
+			if time.Now().Before(s.fxNextRefresh[currency]) {
+				continue
+			}
+
+			interval := fxConfig.Interval
+			if interval == 0 {
+				interval = set.Config.Intervals.Currencies
+			}
+			if !s.getCurrencyRate(ctx, set, currency, fxConfig) && interval > FX_RETRY_INTERVAL {
+				interval = FX_RETRY_INTERVAL
+			}
+			s.fxNextRefresh[currency] = time.Now().Add(interval)
+		}
+
+		if !sleep(ctx, FX_CHECK_INTERVAL) {
+			return
+		}
 	}
 }
 
-func getCurrencyRates() {
-	response, err := http.Get(fmt.Sprintf(BASE_CURRENCY_URI, "TRY"))
-	if err != nil {
-		fmt.Println("failed to get response for currencies : ", err)
-		log.Println("failed to get response for currencies : ", err)
+// getCurrencyRate asks every provider of the currency so they can be
+// compared, and keeps the previous rate when none of them answers.
+func (s *Server) getCurrencyRate(ctx context.Context, set *Settings, currency string, fxConfig FxCurrencyConfig) bool {
+	fetchCtx, cancel := context.WithTimeout(ctx, FX_TIMEOUT)
+	defer cancel()
+
+	sources := make([]FxSourceRate, len(fxConfig.Providers))
+	var wg sync.WaitGroup
+	for i, name := range fxConfig.Providers {
+		wg.Add(1)
+		go func(i int, provider FxProvider) {
+			defer wg.Done()
+			sources[i] = FxSourceRate{Provider: provider.Name()}
+
+			rate, err := provider.FetchRate(fetchCtx, currency)
+			if err == nil && rate <= 0 {
+				err = fmt.Errorf("invalid rate %f", rate)
+			}
+			if err != nil {
+				sources[i].Error = err.Error()
+				fmt.Printf("Failed to get the %s rate from %s : %s\n", currency, provider.Name(), err)
+				log.Printf("Failed to get the %s rate from %s : %s\n", currency, provider.Name(), err)
+				return
+			}
+			sources[i].Rate = rate
+		}(i, s.findFxProvider(name))
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return false
 	}
 
-	responseData, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		fmt.Println("failed to read currency response data : ", err)
-		log.Println("failed to read currency response data : ", err)
+	rate := selectRate(sources, fxConfig.Strategy)
+
+	s.mux.Lock()
+	s.fxSources[currency] = sources
+	if rate > 0 {
+		s.setUSDRate(currency, rate)
 	}
+	s.mux.Unlock()
 
-	tryRateFloat, err := jsonparser.GetString(responseData, "Realtime Currency Exchange Rate", "5. Exchange Rate")
-	if err != nil {
-		fmt.Println("failed to read the TRY currency price from the response data: ", err)
-		log.Println("failed to read the TRY currency price from the response data: ", err)
+	if rate == 0 {
+		s.addWarning(fmt.Sprintf("No rate source answered for %s", currency))
+		return false
 	}
+	s.checkRateDivergence(set, currency, rate, sources)
+	return true
+}
 
-	tempTryRate, _ := strconv.ParseFloat(tryRateFloat, 64)
-	if tempTryRate != 0.0 {
-		tryRate = tempTryRate
+// selectRate returns the median of the answers, or the first answer in the
+// configured order for the fallback strategy. It is 0 when nothing answered.
+func selectRate(sources []FxSourceRate, strategy string) float64 {
+	var rates []float64
+	for _, source := range sources {
+		if source.Rate > 0 {
+			rates = append(rates, source.Rate)
+		}
+	}
+	if len(rates) == 0 {
+		return 0
 	}
 
-	response, err = http.Get(fmt.Sprintf(BASE_CURRENCY_URI, "AED"))
-	if err != nil {
-		fmt.Println("failed to get response for currencies : ", err)
-		log.Println("failed to get response for currencies : ", err)
+	if strategy == FX_FALLBACK {
+		return rates[0]
 	}
 
-	responseData, err = ioutil.ReadAll(response.Body)
-	if err != nil {
-		fmt.Println("failed to read currency response data : ", err)
-		log.Println("failed to read currency response data : ", err)
+	sort.Float64s(rates)
+	middle := len(rates) / 2
+	if len(rates)%2 == 0 {
+		return (rates[middle-1] + rates[middle]) / 2
 	}
+	return rates[middle]
+}
+
+// checkRateDivergence warns when a source is further than the configured
+// percentage from the selected rate. The notification has the same cooldown
+// as the price notifications.
+func (s *Server) checkRateDivergence(set *Settings, currency string, rate float64, sources []FxSourceRate) {
+	limit := set.Config.FX.DivergencePercent
 
-	aedRateFloat, err := jsonparser.GetString(responseData, "Realtime Currency Exchange Rate", "5. Exchange Rate")
-	if err != nil {
-		fmt.Println("failed to read the AED currency price from the response data: ", err)
-		log.Println("failed to read the AED currency price from the response data: ", err)
+	var diverging []string
+	for _, source := range sources {
+		if source.Rate > 0 && math.Abs(source.Rate-rate)*100/rate > limit {
+			diverging = append(diverging, fmt.Sprintf("%s %.4f", source.Provider, source.Rate))
+		}
+	}
+	if len(diverging) == 0 {
+		return
 	}
-	tempAedRate, _ := strconv.ParseFloat(aedRateFloat, 64)
-	if tempAedRate != 0.0 {
-		aedRate = tempAedRate
+
+	message := fmt.Sprintf("USD/%s sources diverge from %.4f : %s", currency, rate, strings.Join(diverging, ", "))
+	s.addWarning(message)
+
+	if s.clock.Now().Sub(s.fxAlerts[currency]).Minutes() >= set.Config.Notification.Duration {
+		s.fxAlerts[currency] = s.clock.Now()
+		s.notify(set, ALERT_FX, message)
 	}
 }
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	DEPTH_KNOWN = "known"
+	// DEPTH_UNKNOWN is reported for the symbols of the venues without an
+	// order book endpoint and for the ones whose book is not fetched yet.
+	DEPTH_UNKNOWN = "depth unknown"
+)
+
+var (
+	DEPTH_LEVELS = 20
+	// Notionals are given in the quote currency of the venue, the USD ones are
+	// converted for the currencies that are not listed.
+	DEPTH_NOTIONALS = map[string][]float64{
+		"TRY": {10000, 50000},
+		"AED": {5000, 25000},
+		"USD": {2000, 10000},
+	}
+)
+
+type OrderBookLevel struct {
+	Price  float64 `json:"price"`
+	Amount float64 `json:"amount"`
+}
+
+type OrderBook struct {
+	Exchange string
+	Currency string
+	ID       string
+	Asks     []OrderBookLevel
+	Bids     []OrderBookLevel
+}
+
+// DepthExchange is implemented by the adapters that can fetch more than the
+// top of the book.
+type DepthExchange interface {
+	Exchange
+	FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error)
+}
+
+// DepthFill is the result of filling a notional against one side of a book.
+type DepthFill struct {
+	Notional float64 `json:"notional"`
+	Filled   float64 `json:"filled"`
+	Amount   float64 `json:"amount"`
+	AvgPrice float64 `json:"avgPrice"`
+	Premium  float64 `json:"premium"`
+}
+
+// DepthAnalysis holds the executable premiums of a venue against the
+// reference price. Ask is buying on the venue, Bid is selling on it.
+// MaxAskNotional and MaxBidNotional are the largest sizes whose average fill
+// still passes the notification minimum and maximum respectively.
+type DepthAnalysis struct {
+	Exchange       string      `json:"exchange"`
+	Symbol         string      `json:"symbol"`
+	Currency       string      `json:"currency"`
+	Status         string      `json:"status"`
+	Reference      string      `json:"reference,omitempty"`
+	ReferencePrice float64     `json:"referencePrice,omitempty"`
+	Ask            []DepthFill `json:"ask,omitempty"`
+	Bid            []DepthFill `json:"bid,omitempty"`
+	MaxAskNotional float64     `json:"maxAskNotional"`
+	MaxBidNotional float64     `json:"maxBidNotional"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+func (s *Server) getDepths(ctx context.Context) {
+	for {
+		cfg := s.currentConfig()
+		s.calculateDepths(ctx, cfg)
+
+		if !sleep(ctx, cfg.Intervals.Depth) {
+			return
+		}
+	}
+}
+
+func (s *Server) calculateDepths(ctx context.Context, cfg *Config) {
+	var wg sync.WaitGroup
+	for _, e := range s.activeExchanges(cfg) {
+		depthExchange, ok := e.(DepthExchange)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(e DepthExchange) {
+			defer wg.Done()
+			for _, symbol := range e.Symbols() {
+				book, err := e.FetchOrderBook(ctx, symbol, DEPTH_LEVELS)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					fmt.Println("Error reading order book : ", err)
+					log.Println("Error reading order book : ", err)
+					continue
+				}
+
+				reference := s.store.Snapshot().CoinbaseProPrices[symbol]
+				s.mux.Lock()
+				referenceExchange, referencePrice := reference.Exchange, reference.Ask*s.referenceRate(cfg, book.Currency)
+				notionals := s.depthNotionals(book.Currency)
+				s.mux.Unlock()
+
+				if referencePrice == 0 {
+					continue
+				}
+
+				analysis := analyseDepth(cfg, book, referenceExchange, referencePrice, notionals, s.clock.Now())
+				s.mux.Lock()
+				s.depths[book.Exchange+"-"+book.ID] = analysis
+				s.mux.Unlock()
+			}
+		}(depthExchange)
+	}
+	wg.Wait()
+}
+
+// depthNotionals must be called with mux held.
+func (s *Server) depthNotionals(currency string) []float64 {
+	if notionals, ok := DEPTH_NOTIONALS[currency]; ok {
+		return notionals
+	}
+
+	var notionals []float64
+	for _, notional := range DEPTH_NOTIONALS["USD"] {
+		notionals = append(notionals, notional*s.usdRate(currency))
+	}
+	return notionals
+}
+
+func analyseDepth(cfg *Config, book OrderBook, referenceExchange string, referencePrice float64, notionals []float64, now time.Time) DepthAnalysis {
+	analysis := DepthAnalysis{
+		Exchange:       book.Exchange,
+		Symbol:         book.ID,
+		Currency:       book.Currency,
+		Status:         DEPTH_KNOWN,
+		Reference:      referenceExchange,
+		ReferencePrice: referencePrice,
+		UpdatedAt:      now,
+	}
+
+	for _, notional := range notionals {
+		analysis.Ask = append(analysis.Ask, fillNotional(book.Asks, notional, referencePrice))
+		analysis.Bid = append(analysis.Bid, fillNotional(book.Bids, notional, referencePrice))
+	}
+
+	analysis.MaxAskNotional = maxNotional(book.Asks, referencePrice*(1+cfg.Notification.Minimum/100), false)
+	analysis.MaxBidNotional = maxNotional(book.Bids, referencePrice*(1+cfg.Notification.Maximum/100), true)
+	return analysis
+}
+
+// fillNotional walks the levels until the notional is spent. Filled is less
+// than Notional when the fetched depth is not enough.
+func fillNotional(levels []OrderBookLevel, notional, referencePrice float64) DepthFill {
+	fill := DepthFill{Notional: notional}
+	for _, level := range levels {
+		if fill.Filled >= notional {
+			break
+		}
+
+		levelNotional := level.Price * level.Amount
+		if fill.Filled+levelNotional > notional {
+			levelNotional = notional - fill.Filled
+		}
+		fill.Filled += levelNotional
+		fill.Amount += levelNotional / level.Price
+	}
+
+	if fill.Amount > 0 {
+		fill.AvgPrice = fill.Filled / fill.Amount
+		fill.Premium = Round((fill.AvgPrice-referencePrice)*100/referencePrice, .5, 2)
+	}
+	return fill
+}
+
+// maxNotional returns the largest notional whose average fill price stays at
+// or above the limit when selling into bids, or at or below it when buying
+// from asks.
+func maxNotional(levels []OrderBookLevel, limit float64, bids bool) float64 {
+	passes := func(price float64) bool {
+		if bids {
+			return price >= limit
+		}
+		return price <= limit
+	}
+
+	notional, amount := 0.0, 0.0
+	for _, level := range levels {
+		levelNotional := level.Price * level.Amount
+		if passes((notional + levelNotional) / (amount + level.Amount)) {
+			notional += levelNotional
+			amount += level.Amount
+			continue
+		}
+
+		// Only part of this level fits, solve (notional+x)/(amount+x/price) = limit.
+		if level.Price != limit {
+			x := (limit*amount - notional) / (1 - limit/level.Price)
+			if x > 0 && x < levelNotional {
+				notional += x
+			}
+		}
+		break
+	}
+	return notional
+}
+
+// parseOrderBookLevels reads the levels found at keys. Each level is either
+// an array or an object, priceKey and amountKey select the fields, and the
+// values may be JSON strings or numbers.
+func parseOrderBookLevels(data []byte, priceKey, amountKey string, keys ...string) ([]OrderBookLevel, error) {
+	var levels []OrderBookLevel
+	var returnError error
+	_, err := jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if returnError != nil {
+			return
+		}
+
+		price, err := parseOrderBookValue(value, priceKey)
+		if err != nil {
+			returnError = fmt.Errorf("failed to read the order book price : %s", err)
+			return
+		}
+
+		amount, err := parseOrderBookValue(value, amountKey)
+		if err != nil {
+			returnError = fmt.Errorf("failed to read the order book amount : %s", err)
+			return
+		}
+
+		levels = append(levels, OrderBookLevel{Price: price, Amount: amount})
+	}, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	return levels, returnError
+}
+
+// parseOrderBookMap reads the levels of an object keyed by price whose values
+// are the amounts, and returns the best depth of them: the highest prices
+// first for bids, the lowest for asks.
+func parseOrderBookMap(data []byte, bids bool, depth int, keys ...string) ([]OrderBookLevel, error) {
+	var levels []OrderBookLevel
+	err := jsonparser.ObjectEach(data, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		price, err := strconv.ParseFloat(string(key), 64)
+		if err != nil {
+			return fmt.Errorf("failed to read the order book price : %s", err)
+		}
+
+		amount, err := strconv.ParseFloat(string(value), 64)
+		if err != nil {
+			return fmt.Errorf("failed to read the order book amount : %s", err)
+		}
+
+		levels = append(levels, OrderBookLevel{Price: price, Amount: amount})
+		return nil
+	}, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(levels, func(i, j int) bool {
+		if bids {
+			return levels[i].Price > levels[j].Price
+		}
+		return levels[i].Price < levels[j].Price
+	})
+	if len(levels) > depth {
+		levels = levels[:depth]
+	}
+	return levels, nil
+}
+
+func parseOrderBookValue(data []byte, key string) (float64, error) {
+	value, _, _, err := jsonparser.Get(data, key)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(value), 64)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"fmt"
+)
+
+var (
+	// Fixed on-chain withdrawal fees, in units of the asset, charged by most
+	// venues.
+	defaultWithdrawalFees = map[string]float64{
+		"BTC": 0.0005, "ETH": 0.005, "LTC": 0.001, "BCH": 0.001, "ETC": 0.01, "ZRX": 5, "XRP": 0.25,
+		"XLM": 0.01, "EOS": 0.1, "USDT": 5, "DOGE": 5, "XEM": 4, "LINK": 0.5, "DASH": 0.002,
+	}
+)
+
+// FeeSchedule describes what an exchange charges. Percentages apply to the
+// traded or transferred value, Withdrawal and Deposit are fixed amounts in
+// units of the asset.
+type FeeSchedule struct {
+	MakerPercent          float64            `yaml:"makerPercent"`
+	TakerPercent          float64            `yaml:"takerPercent"`
+	FiatDepositPercent    float64            `yaml:"fiatDepositPercent"`
+	FiatWithdrawalPercent float64            `yaml:"fiatWithdrawalPercent"`
+	Withdrawal            map[string]float64 `yaml:"withdrawal"`
+	Deposit               map[string]float64 `yaml:"deposit"`
+}
+
+func defaultFeeSchedules() map[string]FeeSchedule {
+	return map[string]FeeSchedule{
+		GDAX:      {MakerPercent: 0.5, TakerPercent: 0.5},
+		BINANCE:   {MakerPercent: 0.1, TakerPercent: 0.1, Withdrawal: map[string]float64{"USDT": 1, "DOGE": 50, "XEM": 4}},
+		PARIBU:    {MakerPercent: 0.25, TakerPercent: 0.35, Withdrawal: defaultWithdrawalFees},
+		BTCTURK:   {MakerPercent: 0.1, TakerPercent: 0.18, Withdrawal: defaultWithdrawalFees},
+		KOINEKS:   {MakerPercent: 0.25, TakerPercent: 0.25, Withdrawal: defaultWithdrawalFees, FiatWithdrawalPercent: 0.1},
+		KOINIM:    {MakerPercent: 0.3, TakerPercent: 0.3, Withdrawal: defaultWithdrawalFees},
+		VEBITCOIN: {MakerPercent: 0.25, TakerPercent: 0.25, Withdrawal: defaultWithdrawalFees},
+		BITOASIS:  {MakerPercent: 0.5, TakerPercent: 0.5, Withdrawal: defaultWithdrawalFees, FiatWithdrawalPercent: 0.5},
+		BITFINEX:  {MakerPercent: 0.1, TakerPercent: 0.2, Withdrawal: defaultWithdrawalFees},
+		CEXIO:     {MakerPercent: 0.16, TakerPercent: 0.25, Withdrawal: defaultWithdrawalFees, FiatWithdrawalPercent: 1},
+	}
+}
+
+func (f FeeSchedule) validate() error {
+	for _, percent := range []float64{f.MakerPercent, f.TakerPercent, f.FiatDepositPercent, f.FiatWithdrawalPercent} {
+		if percent < 0 || percent >= 100 {
+			return fmt.Errorf("fee percentages must be between 0 and 100")
+		}
+	}
+	for _, fees := range []map[string]float64{f.Withdrawal, f.Deposit} {
+		for asset, fee := range fees {
+			if fee < 0 {
+				return fmt.Errorf("fee of %s cannot be negative", asset)
+			}
+		}
+	}
+	return nil
+}
+
+// feeSchedule returns the configured fees of the exchange. A config missing
+// the fees of an enabled exchange or of a reference is not applied, the
+// zero schedule is only returned for the other exchanges.
+func feeSchedule(cfg *Config, exchange string) FeeSchedule {
+	return cfg.Fees[exchange]
+}
+
+// tradeNotional is the trade size fixed transfer fees are spread over. It
+// must be called with mux held.
+func (s *Server) tradeNotional(currency string) float64 {
+	if notionals := s.depthNotionals(currency); len(notionals) > 0 {
+		return notionals[0]
+	}
+	return 0
+}
+
+// calculateNetDiffs returns the ask and bid diffs of p against referencePrice
+// after the fees of a full round trip of notional, both in p's currency. The
+// ask diff buys on p's exchange and sells on the reference, the bid diff buys
+// on the reference and sells on p's exchange. Without fees they are equal to
+// the raw diffs.
+func calculateNetDiffs(cfg *Config, referenceExchange string, referencePrice float64, p Price, notional float64) (float64, float64) {
+	reference := feeSchedule(cfg, referenceExchange)
+	venue := feeSchedule(cfg, p.Exchange)
+
+	if referencePrice <= 0 || p.Ask <= 0 || p.Bid <= 0 {
+		return 100, -100
+	}
+	if notional <= 0 {
+		notional = referencePrice
+	}
+
+	units := notional * (1 - venue.FiatDepositPercent/100) / (p.Ask * (1 + venue.TakerPercent/100))
+	units -= venue.Withdrawal[p.ID] + reference.Deposit[p.ID]
+	askProceeds := units * referencePrice * (1 - reference.TakerPercent/100) * (1 - reference.FiatWithdrawalPercent/100)
+
+	units = notional * (1 - reference.FiatDepositPercent/100) / (referencePrice * (1 + reference.TakerPercent/100))
+	units -= reference.Withdrawal[p.ID] + venue.Deposit[p.ID]
+	bidProceeds := units * p.Bid * (1 - venue.TakerPercent/100) * (1 - venue.FiatWithdrawalPercent/100)
+
+	netAsk, netBid := 100.0, -100.0
+	if askProceeds > 0 {
+		netAsk = (notional/askProceeds - 1) * 100
+	}
+	if bidProceeds > 0 {
+		netBid = (bidProceeds/notional - 1) * 100
+	}
+	return Round(netAsk, .5, 2), Round(netBid, .5, 2)
+}
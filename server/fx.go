@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	ALPHAVANTAGE = "alphaVantage"
+	CENTRAL_BANK = "centralBank"
+	IMPLIED      = "implied"
+
+	// The sources of the central bank rates in the HTTP accounting.
+	TCMB = "TCMB"
+	ECB  = "ECB"
+
+	TCMB_URI = "https://www.tcmb.gov.tr/kurlar/today.xml"
+	ECB_URI  = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+	// The UAE dirham has been pegged to the dollar since 1997.
+	AED_PEG = 3.6725
+)
+
+var (
+	// FX_PROVIDERS are the names the currencies of the config can list.
+	FX_PROVIDERS = []string{ALPHAVANTAGE, CENTRAL_BANK, IMPLIED}
+)
+
+// FxProvider returns how many units of a currency one USD buys.
+type FxProvider interface {
+	Name() string
+	FetchRate(ctx context.Context, currency string) (float64, error)
+}
+
+func (s *Server) findFxProvider(name string) FxProvider {
+	for _, p := range s.fxProviders {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+type alphaVantageProvider struct {
+	venue
+}
+
+func (alphaVantageProvider) Name() string {
+	return ALPHAVANTAGE
+}
+
+func (p alphaVantageProvider) FetchRate(ctx context.Context, currency string) (float64, error) {
+	key := p.config().Credentials.AlphaVantageKey
+	if key == "" {
+		return 0, fmt.Errorf("no AlphaVantage API key is configured")
+	}
+
+	responseData, err := p.httpGet(ctx, ALPHAVANTAGE, fmt.Sprintf(BASE_CURRENCY_URI, currency, key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get AlphaVantage response : %s", err)
+	}
+
+	rate, err := jsonparser.GetString(responseData, "Realtime Currency Exchange Rate", "5. Exchange Rate")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the %s rate from the AlphaVantage response data : %s", currency, err)
+	}
+	return strconv.ParseFloat(rate, 64)
+}
+
+// centralBankProvider uses the Turkish central bank indicative rates for TRY,
+// the official peg for AED and the ECB reference rates for the rest.
+type centralBankProvider struct {
+	venue
+}
+
+type tcmbRates struct {
+	Currencies []struct {
+		Code         string `xml:"CurrencyCode,attr"`
+		ForexBuying  string `xml:"ForexBuying"`
+		ForexSelling string `xml:"ForexSelling"`
+	} `xml:"Currency"`
+}
+
+type ecbRates struct {
+	Rates []struct {
+		Currency string  `xml:"currency,attr"`
+		Rate     float64 `xml:"rate,attr"`
+	} `xml:"Cube>Cube>Cube"`
+}
+
+func (centralBankProvider) Name() string {
+	return CENTRAL_BANK
+}
+
+func (p centralBankProvider) FetchRate(ctx context.Context, currency string) (float64, error) {
+	switch currency {
+	case "AED":
+		return AED_PEG, nil
+	case "TRY":
+		return p.fetchTCMBRate(ctx)
+	}
+	return p.fetchECBRate(ctx, currency)
+}
+
+func (p centralBankProvider) fetchTCMBRate(ctx context.Context) (float64, error) {
+	responseData, err := p.httpGet(ctx, TCMB, TCMB_URI)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TCMB response : %s", err)
+	}
+
+	var rates tcmbRates
+	if err := xml.Unmarshal(responseData, &rates); err != nil {
+		return 0, fmt.Errorf("failed to parse the TCMB response data : %s", err)
+	}
+
+	for _, c := range rates.Currencies {
+		if c.Code != "USD" {
+			continue
+		}
+
+		buying, err := strconv.ParseFloat(c.ForexBuying, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the USD buying rate from the TCMB response data : %s", err)
+		}
+		selling, err := strconv.ParseFloat(c.ForexSelling, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the USD selling rate from the TCMB response data : %s", err)
+		}
+		return (buying + selling) / 2, nil
+	}
+	return 0, fmt.Errorf("no USD rate in the TCMB response data")
+}
+
+// fetchECBRate crosses the euro reference rates of the currency and USD.
+func (p centralBankProvider) fetchECBRate(ctx context.Context, currency string) (float64, error) {
+	responseData, err := p.httpGet(ctx, ECB, ECB_URI)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ECB response : %s", err)
+	}
+
+	var rates ecbRates
+	if err := xml.Unmarshal(responseData, &rates); err != nil {
+		return 0, fmt.Errorf("failed to parse the ECB response data : %s", err)
+	}
+
+	perEuro := map[string]float64{"EUR": 1}
+	for _, r := range rates.Rates {
+		perEuro[r.Currency] = r.Rate
+	}
+
+	if perEuro["USD"] == 0 {
+		return 0, fmt.Errorf("no USD rate in the ECB response data")
+	}
+	if perEuro[currency] == 0 {
+		return 0, fmt.Errorf("no central bank rate for %s", currency)
+	}
+	return perEuro[currency] / perEuro["USD"], nil
+}
+
+// impliedProvider averages the mid prices of the fresh stablecoin quotes on
+// the venues of the currency. It needs no request of its own.
+type impliedProvider struct {
+	s *Server
+}
+
+func (impliedProvider) Name() string {
+	return IMPLIED
+}
+
+func (p impliedProvider) FetchRate(ctx context.Context, currency string) (float64, error) {
+	m := p.s.store.Snapshot()
+	cfg := p.s.currentConfig()
+
+	p.s.mux.Lock()
+	defer p.s.mux.Unlock()
+	return p.s.impliedUSDRate(m, cfg, currency, p.s.clock.Now())
+}
+
+// impliedUSDRate averages the quotes of the stablecoins of cfg. It must be
+// called with mux held.
+func (s *Server) impliedUSDRate(m *MarketState, cfg *Config, currency string, now time.Time) (float64, error) {
+	sum, count := 0.0, 0
+	for _, e := range s.activeExchanges(cfg) {
+		if e.Currency() != currency {
+			continue
+		}
+
+		for _, p := range m.ExchangePrices[e.Name()] {
+			if !containsSymbol(cfg.FX.Stablecoins, p.ID) || p.Ask <= 0 || p.Bid <= 0 || s.isStale(cfg, p, now) {
+				continue
+			}
+			sum += (p.Ask + p.Bid) / 2
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("no fresh stablecoin quotes in %s", currency)
+	}
+	return sum / float64(count), nil
+}
@@ -0,0 +1,505 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HISTORY_SEGMENT_DURATION = time.Hour
+	HISTORY_COMPACT_AFTER    = 24 * time.Hour
+	HISTORY_RETENTION        = 30 * 24 * time.Hour
+	// HISTORY_QUERY_LIMIT is the page size of the history endpoint, up to
+	// HISTORY_MAX_QUERY_LIMIT records can be asked for.
+	HISTORY_QUERY_LIMIT     = 5000
+	HISTORY_MAX_QUERY_LIMIT = 50000
+	// HISTORY_THRESHOLD_LIMIT bounds the records of a range the time above
+	// a threshold is computed over.
+	HISTORY_THRESHOLD_LIMIT = 200000
+
+	HISTORY_PRICE    = "price"
+	HISTORY_DIFF     = "diff"
+	HISTORY_NET_DIFF = "netDiff"
+	HISTORY_SPREAD   = "spread"
+
+	historySegmentExt = ".seg"
+)
+
+// HistoryRecord is a single observation. Records are only written when the
+// value of a series changes, so a series is a step function over time.
+type HistoryRecord struct {
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"kind"`
+	Reference string    `json:"reference,omitempty"`
+	Exchange  string    `json:"exchange"`
+	Symbol    string    `json:"symbol"`
+	Side      string    `json:"side,omitempty"`
+	Value     float64   `json:"value"`
+}
+
+func (r HistoryRecord) key() string {
+	return strings.Join([]string{r.Kind, r.Reference, r.Exchange, r.Symbol, r.Side}, "|")
+}
+
+// HistoryQuery selects records of a time range. Empty fields match anything.
+// Limit is the number of records returned after skipping Offset of them, 0
+// returns all.
+type HistoryQuery struct {
+	Kind      string
+	Reference string
+	Exchange  string
+	Symbol    string
+	Side      string
+	From      time.Time
+	To        time.Time
+	Offset    int
+	Limit     int
+}
+
+func (q HistoryQuery) matches(r HistoryRecord) bool {
+	return (q.Kind == "" || q.Kind == r.Kind) &&
+		(q.Reference == "" || q.Reference == r.Reference) &&
+		(q.Exchange == "" || q.Exchange == r.Exchange) &&
+		(q.Symbol == "" || q.Symbol == r.Symbol) &&
+		(q.Side == "" || q.Side == r.Side)
+}
+
+// HistoryStore keeps price, diff and spread series in append-only segment
+// files named "<start>-<end>.seg" (unix seconds). Every segment begins with a
+// keyframe holding the last known value of every series, so expired segments
+// can be removed without losing the state of the ones that follow.
+type HistoryStore struct {
+	dir             string
+	clock           Clock
+	segmentDuration time.Duration
+	compactAfter    time.Duration
+	retention       time.Duration
+
+	// files keeps the segments a query reads from being compacted or
+	// expired under it. It is taken after mu, never before.
+	files sync.RWMutex
+
+	mu           sync.Mutex
+	last         map[string]HistoryRecord
+	written      map[string]HistoryRecord
+	pending      []HistoryRecord
+	segment      *os.File
+	writer       *bufio.Writer
+	segmentStart time.Time
+	// closed rejects the records of the loops that outlive Close.
+	closed bool
+}
+
+type historySegment struct {
+	path       string
+	start, end time.Time
+}
+
+// NewHistoryStore keeps the segments in dir. The records are stamped by their
+// producers, clock only ends the queries without an end.
+func NewHistoryStore(dir string, clock Clock) (*HistoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory %s : %s", dir, err)
+	}
+
+	h := &HistoryStore{
+		dir:             dir,
+		clock:           clock,
+		segmentDuration: HISTORY_SEGMENT_DURATION,
+		compactAfter:    HISTORY_COMPACT_AFTER,
+		retention:       HISTORY_RETENTION,
+		last:            map[string]HistoryRecord{},
+		written:         map[string]HistoryRecord{},
+	}
+	return h, nil
+}
+
+// Append buffers the record if it changes the value of its series. Buffered
+// records reach the disk on the next Flush.
+func (h *HistoryStore) Append(r HistoryRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	key := r.key()
+	if last, ok := h.last[key]; ok && last.Value == r.Value {
+		return
+	}
+	h.last[key] = r
+	h.pending = append(h.pending, r)
+}
+
+func (h *HistoryStore) Flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	return h.flush()
+}
+
+func (h *HistoryStore) flush() error {
+	for _, r := range h.pending {
+		if h.segment == nil || !r.Time.Before(h.segmentStart.Add(h.segmentDuration)) {
+			if err := h.rotate(r.Time); err != nil {
+				return err
+			}
+		}
+
+		if err := h.write(r); err != nil {
+			return err
+		}
+	}
+	h.pending = nil
+
+	if h.writer == nil {
+		return nil
+	}
+	return h.writer.Flush()
+}
+
+// Close writes the buffered records and closes the segment. The records
+// appended after it are dropped.
+func (h *HistoryStore) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if err := h.flush(); err != nil {
+		h.closeSegment()
+		return err
+	}
+	return h.closeSegment()
+}
+
+// rotate closes the current segment and opens the one covering t, writing
+// the keyframe first. Retention and compaction run on every rotation.
+func (h *HistoryStore) rotate(t time.Time) error {
+	if err := h.closeSegment(); err != nil {
+		return err
+	}
+
+	start := t.Truncate(h.segmentDuration)
+	end := start.Add(h.segmentDuration)
+	path := filepath.Join(h.dir, fmt.Sprintf("%d-%d%s", start.Unix(), end.Unix(), historySegmentExt))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history segment %s : %s", path, err)
+	}
+	h.segment = file
+	h.writer = bufio.NewWriter(file)
+	h.segmentStart = start
+
+	for _, r := range h.written {
+		keyframe := r
+		if keyframe.Time.Before(start) {
+			keyframe.Time = start
+		}
+		if err := h.write(keyframe); err != nil {
+			return err
+		}
+	}
+
+	return h.maintain(t)
+}
+
+func (h *HistoryStore) write(r HistoryRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode history record : %s", err)
+	}
+
+	line = append(line, '\n')
+	if _, err := h.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to write history record : %s", err)
+	}
+	h.written[r.key()] = r
+	return nil
+}
+
+func (h *HistoryStore) closeSegment() error {
+	if h.segment == nil {
+		return nil
+	}
+
+	if err := h.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush history segment : %s", err)
+	}
+	err := h.segment.Close()
+	h.segment, h.writer = nil, nil
+	return err
+}
+
+// Query returns the page of the records matching q in time order, and
+// whether more follow it. The value each series had at q.From is reported as
+// a record stamped q.From. The segments are read without holding mu, so the
+// appends and flushes go on meanwhile, and no more records are kept than the
+// page needs.
+func (h *HistoryStore) Query(q HistoryQuery) ([]HistoryRecord, bool, error) {
+	if err := h.Flush(); err != nil {
+		return nil, false, err
+	}
+
+	if q.To.IsZero() {
+		q.To = h.clock.Now()
+	}
+
+	h.files.RLock()
+	defer h.files.RUnlock()
+
+	segments, err := h.segments()
+	if err != nil {
+		return nil, false, err
+	}
+
+	before := map[string]HistoryRecord{}
+	var records []HistoryRecord
+	// The segments and their records are in time order, the ones past the
+	// page and the one telling whether more follow are not needed.
+	full := func() bool { return q.Limit > 0 && len(records) > q.Offset+q.Limit }
+	for _, s := range segments {
+		if full() {
+			break
+		}
+		if !s.end.After(q.From) || s.start.After(q.To) {
+			continue
+		}
+
+		err := readHistorySegment(s.path, func(r HistoryRecord) {
+			if !q.matches(r) || r.Time.After(q.To) || full() {
+				return
+			}
+
+			if r.Time.Before(q.From) {
+				before[r.key()] = r
+				return
+			}
+			records = append(records, r)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var initial []HistoryRecord
+	for _, r := range before {
+		r.Time = q.From
+		initial = append(initial, r)
+	}
+	sort.Slice(initial, func(i, j int) bool { return initial[i].key() < initial[j].key() })
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+
+	records, more := pageHistory(append(initial, records...), q.Offset, q.Limit)
+	return records, more, nil
+}
+
+// pageHistory returns limit records of list after skipping offset of them,
+// all of them when limit is 0, and whether more follow.
+func pageHistory(list []HistoryRecord, offset, limit int) ([]HistoryRecord, bool) {
+	if offset >= len(list) {
+		return nil, false
+	}
+	list = list[offset:]
+	if limit > 0 && len(list) > limit {
+		return list[:limit], true
+	}
+	return list, false
+}
+
+// maintain drops segments past the retention period and merges the hourly
+// segments older than compactAfter into one segment per day. It waits for the
+// queries reading the segments.
+func (h *HistoryStore) maintain(now time.Time) error {
+	h.files.Lock()
+	defer h.files.Unlock()
+
+	segments, err := h.segments()
+	if err != nil {
+		return err
+	}
+
+	days := map[time.Time][]historySegment{}
+	for _, s := range segments {
+		if s.end.Before(now.Add(-h.retention)) {
+			if err := os.Remove(s.path); err != nil {
+				return fmt.Errorf("failed to remove expired history segment %s : %s", s.path, err)
+			}
+			continue
+		}
+
+		if s.end.After(now.Add(-h.compactAfter)) {
+			continue
+		}
+
+		day := s.start.UTC().Truncate(24 * time.Hour)
+		days[day] = append(days[day], s)
+	}
+
+	for day, list := range days {
+		if len(list) < 2 {
+			continue
+		}
+		if err := h.compact(day, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *HistoryStore) compact(day time.Time, list []historySegment) error {
+	path := filepath.Join(h.dir, fmt.Sprintf("%d-%d%s", day.Unix(), day.Add(24*time.Hour).Unix(), historySegmentExt))
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted history segment : %s", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	// Keyframes of the later segments repeat values that are already known,
+	// only the first occurrence and real changes are kept.
+	last := map[string]float64{}
+	var encodeErr error
+	for _, s := range list {
+		err := readHistorySegment(s.path, func(r HistoryRecord) {
+			if value, ok := last[r.key()]; ok && value == r.Value {
+				return
+			}
+			last[r.key()] = r.Value
+			if err := encoder.Encode(r); err != nil && encodeErr == nil {
+				encodeErr = err
+			}
+		})
+		if err == nil {
+			err = encodeErr
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to compact history segment %s : %s", s.path, err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write compacted history segment : %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	for _, s := range list {
+		if s.path != path {
+			if err := os.Remove(s.path); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (h *HistoryStore) segments() ([]historySegment, error) {
+	files, err := ioutil.ReadDir(h.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history segments : %s", err)
+	}
+
+	var segments []historySegment
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, historySegmentExt) {
+			continue
+		}
+
+		bounds := strings.Split(strings.TrimSuffix(name, historySegmentExt), "-")
+		if len(bounds) != 2 {
+			continue
+		}
+		start, err := strconv.ParseInt(bounds[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, historySegment{
+			path:  filepath.Join(h.dir, name),
+			start: time.Unix(start, 0),
+			end:   time.Unix(end, 0),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start.Before(segments[j].start) })
+	return segments, nil
+}
+
+func readHistorySegment(path string, fn func(HistoryRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r HistoryRecord
+		// A torn last line after a crash is skipped rather than failing the
+		// whole segment.
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		fn(r)
+	}
+	return scanner.Err()
+}
+
+// DurationAbove returns how long each series in records stayed above the
+// threshold until the given time. Records must be in time order.
+func DurationAbove(records []HistoryRecord, threshold float64, until time.Time) map[string]time.Duration {
+	durations := map[string]time.Duration{}
+	last := map[string]HistoryRecord{}
+	for _, r := range records {
+		key := r.key()
+		if prev, ok := last[key]; ok && prev.Value > threshold {
+			durations[key] += r.Time.Sub(prev.Time)
+		}
+		if _, ok := durations[key]; !ok {
+			durations[key] = 0
+		}
+		last[key] = r
+	}
+
+	for key, prev := range last {
+		if prev.Value > threshold && until.After(prev.Time) {
+			durations[key] += until.Sub(prev.Time)
+		}
+	}
+	return durations
+}
+
+func (s *Server) recordHistory(r HistoryRecord) {
+	if s.history == nil {
+		return
+	}
+	s.history.Append(r)
+}
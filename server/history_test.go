@@ -0,0 +1,239 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c testClock) Now() time.Time {
+	return c.now
+}
+
+var historyStart = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+func newTestHistory(t *testing.T, now time.Time) *HistoryStore {
+	h, err := NewHistoryStore(t.TempDir(), testClock{now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func priceRecord(exchange string, at time.Duration, value float64) HistoryRecord {
+	return HistoryRecord{Time: historyStart.Add(at), Kind: HISTORY_PRICE, Exchange: exchange, Symbol: "BTC", Value: value}
+}
+
+func appendHistory(t *testing.T, h *HistoryStore, records ...HistoryRecord) {
+	for _, r := range records {
+		h.Append(r)
+	}
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readSegments returns the records of every segment of h by segment start.
+func readSegments(t *testing.T, h *HistoryStore) ([]historySegment, [][]HistoryRecord) {
+	segments, err := h.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var contents [][]HistoryRecord
+	for _, s := range segments {
+		var records []HistoryRecord
+		if err := readHistorySegment(s.path, func(r HistoryRecord) { records = append(records, r) }); err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, records)
+	}
+	return segments, contents
+}
+
+func sameRecords(got, want []HistoryRecord) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !got[i].Time.Equal(want[i].Time) || got[i].key() != want[i].key() || got[i].Value != want[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHistoryRotatesSegmentsWithKeyframes(t *testing.T) {
+	h := newTestHistory(t, historyStart)
+
+	appendHistory(t, h,
+		priceRecord(PARIBU, 10*time.Minute, 1),
+		priceRecord(BTCTURK, 20*time.Minute, 2),
+		// An unchanged value is not written.
+		priceRecord(PARIBU, 30*time.Minute, 1),
+	)
+	appendHistory(t, h, priceRecord(PARIBU, 70*time.Minute, 3))
+
+	segments, contents := readSegments(t, h)
+	if len(segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(segments))
+	}
+	if !segments[1].start.Equal(historyStart.Add(time.Hour)) || !segments[1].end.Equal(historyStart.Add(2*time.Hour)) {
+		t.Errorf("second segment covers %s to %s", segments[1].start, segments[1].end)
+	}
+
+	first := []HistoryRecord{priceRecord(PARIBU, 10*time.Minute, 1), priceRecord(BTCTURK, 20*time.Minute, 2)}
+	if !sameRecords(contents[0], first) {
+		t.Errorf("first segment holds %v, want %v", contents[0], first)
+	}
+
+	// The keyframe restates both series at the start of the segment, the
+	// order of the series in it is not defined.
+	second := contents[1]
+	if len(second) != 3 || !sameRecords(second[2:], []HistoryRecord{priceRecord(PARIBU, 70*time.Minute, 3)}) {
+		t.Fatalf("second segment holds %v", second)
+	}
+	keyframe := map[string]float64{}
+	for _, r := range second[:2] {
+		if !r.Time.Equal(segments[1].start) {
+			t.Errorf("keyframe record %v is not stamped at the segment start", r)
+		}
+		keyframe[r.Exchange] = r.Value
+	}
+	if want := map[string]float64{PARIBU: 1, BTCTURK: 2}; !reflect.DeepEqual(keyframe, want) {
+		t.Errorf("keyframe is %v, want %v", keyframe, want)
+	}
+}
+
+func TestHistoryCompactsAndExpiresSegments(t *testing.T) {
+	h := newTestHistory(t, historyStart)
+
+	appendHistory(t, h, priceRecord(PARIBU, 0, 1))
+	appendHistory(t, h, priceRecord(PARIBU, time.Hour, 2))
+	appendHistory(t, h, priceRecord(PARIBU, 2*time.Hour, 3))
+	// The next day is not 24 hours old yet when the last segment opens.
+	appendHistory(t, h, priceRecord(PARIBU, 26*time.Hour, 4))
+	appendHistory(t, h, priceRecord(PARIBU, 27*time.Hour, 5))
+	appendHistory(t, h, priceRecord(PARIBU, 50*time.Hour, 6))
+
+	segments, contents := readSegments(t, h)
+	if len(segments) != 4 {
+		t.Fatalf("got %d segments, want 4", len(segments))
+	}
+	if !segments[0].start.Equal(historyStart) || !segments[0].end.Equal(historyStart.Add(24*time.Hour)) {
+		t.Errorf("compacted segment covers %s to %s", segments[0].start, segments[0].end)
+	}
+	// The keyframes repeating the last value of the previous hour are gone.
+	day := []HistoryRecord{priceRecord(PARIBU, 0, 1), priceRecord(PARIBU, time.Hour, 2), priceRecord(PARIBU, 2*time.Hour, 3)}
+	if !sameRecords(contents[0], day) {
+		t.Errorf("compacted segment holds %v, want %v", contents[0], day)
+	}
+
+	// The first day expires once it ended more than 30 days ago.
+	appendHistory(t, h, priceRecord(PARIBU, 31*24*time.Hour+time.Minute, 7))
+	segments, _ = readSegments(t, h)
+	for _, s := range segments {
+		if s.start.Equal(historyStart) {
+			t.Errorf("segment %s was not expired", s.path)
+		}
+	}
+	if !segments[0].start.Equal(historyStart.Add(24 * time.Hour)) {
+		t.Errorf("oldest segment starts at %s, want the second day", segments[0].start)
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	h := newTestHistory(t, historyStart.Add(3*time.Hour))
+
+	appendHistory(t, h,
+		priceRecord(PARIBU, 10*time.Minute, 1),
+		priceRecord(BTCTURK, 20*time.Minute, 2),
+		priceRecord(PARIBU, 40*time.Minute, 3),
+	)
+	appendHistory(t, h, priceRecord(PARIBU, 90*time.Minute, 4), priceRecord(PARIBU, 100*time.Minute, 5))
+
+	// The value at From is reported as a record stamped From, To defaults to
+	// the time of the clock. The keyframe of the second segment restates the
+	// value of the first.
+	records, more, err := h.Query(HistoryQuery{Exchange: PARIBU, From: historyStart.Add(30 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistoryRecord{
+		priceRecord(PARIBU, 30*time.Minute, 1),
+		priceRecord(PARIBU, 40*time.Minute, 3),
+		priceRecord(PARIBU, time.Hour, 3),
+		priceRecord(PARIBU, 90*time.Minute, 4),
+		priceRecord(PARIBU, 100*time.Minute, 5),
+	}
+	if more || !sameRecords(records, want) {
+		t.Errorf("got %v (more %v), want %v", records, more, want)
+	}
+
+	records, more, err = h.Query(HistoryQuery{Exchange: PARIBU, From: historyStart, To: historyStart.Add(95 * time.Minute), Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []HistoryRecord{priceRecord(PARIBU, 40*time.Minute, 3)}; !more || !sameRecords(records, want) {
+		t.Errorf("got %v (more %v), want %v and more", records, more, want)
+	}
+
+	records, more, err = h.Query(HistoryQuery{Exchange: PARIBU, From: historyStart, To: historyStart.Add(95 * time.Minute), Offset: 2, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []HistoryRecord{priceRecord(PARIBU, time.Hour, 3), priceRecord(PARIBU, 90*time.Minute, 4)}; more || !sameRecords(records, want) {
+		t.Errorf("got %v (more %v), want %v", records, more, want)
+	}
+}
+
+func TestPageHistory(t *testing.T) {
+	list := []HistoryRecord{priceRecord(PARIBU, 0, 1), priceRecord(PARIBU, time.Minute, 2), priceRecord(PARIBU, 2*time.Minute, 3)}
+
+	tests := []struct {
+		offset, limit int
+		want          []HistoryRecord
+		more          bool
+	}{
+		{0, 0, list, false},
+		{0, 2, list[:2], true},
+		{1, 2, list[1:], false},
+		{2, 1, list[2:], false},
+		{3, 1, nil, false},
+	}
+	for _, test := range tests {
+		got, more := pageHistory(list, test.offset, test.limit)
+		if more != test.more || !sameRecords(got, test.want) {
+			t.Errorf("offset %d limit %d: got %v (more %v), want %v (more %v)", test.offset, test.limit, got, more, test.want, test.more)
+		}
+	}
+}
+
+func TestDurationAbove(t *testing.T) {
+	records := []HistoryRecord{
+		priceRecord(PARIBU, 0, 5),
+		priceRecord(BTCTURK, 0, 1),
+		priceRecord(PARIBU, 10*time.Minute, 1),
+		priceRecord(BTCTURK, 20*time.Minute, 4),
+		priceRecord(PARIBU, 30*time.Minute, 6),
+	}
+
+	got := DurationAbove(records, 3, historyStart.Add(time.Hour))
+	want := map[string]time.Duration{
+		priceRecord(PARIBU, 0, 0).key():  40 * time.Minute,
+		priceRecord(BTCTURK, 0, 0).key(): 40 * time.Minute,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = DurationAbove(records, 10, historyStart.Add(time.Hour))
+	if got[priceRecord(PARIBU, 0, 0).key()] != 0 || len(got) != 2 {
+		t.Errorf("got %v, want no time above", got)
+	}
+}
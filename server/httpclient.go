@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	HTTP_MIN_BACKOFF = 500 * time.Millisecond
+	HTTP_MAX_BACKOFF = 10 * time.Second
+)
+
+// RequestStats accounts the requests made for one source. A request retried
+// twice counts once in Requests and twice in Retries.
+type RequestStats struct {
+	Requests     int64         `json:"requests"`
+	Errors       int64         `json:"errors"`
+	Retries      int64         `json:"retries"`
+	RateLimited  int64         `json:"rateLimited"`
+	LastStatus   int           `json:"lastStatus,omitempty"`
+	LastLatency  time.Duration `json:"lastLatency"`
+	TotalLatency time.Duration `json:"totalLatency"`
+	LastError    string        `json:"lastError,omitempty"`
+	LastErrorAt  time.Time     `json:"lastErrorAt,omitempty"`
+	// Skipped counts the requests not made while the source was blocked
+	// until BlockedUntil by a Retry-After.
+	Skipped      int64     `json:"skipped"`
+	BlockedUntil time.Time `json:"blockedUntil,omitempty"`
+}
+
+// HTTPClient is shared by the exchange and rate fetchers. Every request waits
+// for the budget of its source, has its timeout, is retried with a jittered
+// backoff on network errors, 429 and 5xx responses, and fails on any other
+// status than 2xx or a body larger than the configured maximum.
+type HTTPClient struct {
+	client *http.Client
+	// settings are the ones of the Server using the client, the defaults
+	// apply until it is given to one.
+	settings *settingsStore
+
+	mu      sync.Mutex
+	stats   map[string]*RequestStats
+	budgets map[string]*tokenBucket
+}
+
+// NewHTTPClient adds the budgets, retries and accounting of the fetchers to
+// client.
+func NewHTTPClient(client *http.Client) *HTTPClient {
+	return &HTTPClient{client: client, stats: map[string]*RequestStats{}, budgets: map[string]*tokenBucket{}}
+}
+
+// Get follows the settings current when the request starts.
+func (c *HTTPClient) Get(ctx context.Context, source, uri string) ([]byte, error) {
+	config := defaultConfig()
+	if c.settings != nil {
+		config = c.settings.Snapshot().Config
+	}
+	cfg := config.HTTP
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var (
+			data       []byte
+			retryAfter time.Duration
+			retry      bool
+		)
+
+		if err := c.waitForBudget(ctx, config, source); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		data, retryAfter, retry, err = c.get(ctx, cfg, source, uri)
+		c.account(source, time.Since(start), attempt > 0, retryAfter > 0, err)
+		if err == nil {
+			return data, nil
+		}
+		// The other requests of the source wait as long as the server asked
+		// for, the polls included.
+		if retryAfter > 0 {
+			c.budget(config, source).block(start.Add(retryAfter))
+		}
+		if !retry || attempt >= cfg.Retries {
+			return nil, err
+		}
+
+		// A server asking for a longer wait than HTTP_MAX_BACKOFF is not
+		// waited for, the next poll after the wait tries again.
+		if retryAfter > HTTP_MAX_BACKOFF {
+			return nil, fmt.Errorf("%s, retry after %s is longer than %s", err, retryAfter, HTTP_MAX_BACKOFF)
+		}
+		wait := retryAfter
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, fmt.Errorf("%s, no time left to retry", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// get makes a single attempt. It returns the wait a 429 response asked for
+// and whether the request can be retried.
+func (c *HTTPClient) get(ctx context.Context, cfg HTTPConfig, source, uri string) ([]byte, time.Duration, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout(cfg, source))
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		// A timed out attempt is retried unless the caller gave up.
+		return nil, 0, ctx.Err() != context.Canceled, err
+	}
+	defer response.Body.Close()
+
+	c.mu.Lock()
+	c.statsOf(source).LastStatus = response.StatusCode
+	c.mu.Unlock()
+
+	responseData, err := ioutil.ReadAll(io.LimitReader(response.Body, cfg.MaxBodyBytes+1))
+	if err != nil {
+		return nil, 0, true, fmt.Errorf("failed to read response data : %s", err)
+	}
+	if int64(len(responseData)) > cfg.MaxBodyBytes {
+		return nil, 0, false, fmt.Errorf("response data is larger than %d bytes", cfg.MaxBodyBytes)
+	}
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		wait := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		if wait == 0 {
+			wait = HTTP_MIN_BACKOFF
+		}
+		return nil, wait, true, fmt.Errorf("rate limited : %s", response.Status)
+	case response.StatusCode == http.StatusServiceUnavailable:
+		wait := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		return nil, wait, true, fmt.Errorf("unexpected status %s", response.Status)
+	case response.StatusCode >= 500:
+		return nil, 0, true, fmt.Errorf("unexpected status %s", response.Status)
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return nil, 0, false, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return responseData, 0, false, nil
+}
+
+// account must not be called with c.mu held.
+func (c *HTTPClient) account(source string, latency time.Duration, retried, rateLimited bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.statsOf(source)
+	if retried {
+		stats.Retries++
+	} else {
+		stats.Requests++
+	}
+	if rateLimited {
+		stats.RateLimited++
+	}
+	stats.LastLatency = latency
+	stats.TotalLatency += latency
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		stats.LastErrorAt = time.Now()
+	}
+}
+
+// statsOf must be called with c.mu held.
+func (c *HTTPClient) statsOf(source string) *RequestStats {
+	stats, ok := c.stats[source]
+	if !ok {
+		stats = &RequestStats{}
+		c.stats[source] = stats
+	}
+	return stats
+}
+
+// Stats returns a copy of the accounting of every source.
+func (c *HTTPClient) Stats() map[string]RequestStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := map[string]RequestStats{}
+	for source, stats := range c.stats {
+		result[source] = *stats
+	}
+	for source, b := range c.budgets {
+		if until, blocked := b.blocked(time.Now()); blocked {
+			stats := result[source]
+			stats.BlockedUntil = until
+			result[source] = stats
+		}
+	}
+	return result
+}
+
+// httpTimeout returns the timeout of the source, or the default one.
+func httpTimeout(cfg HTTPConfig, source string) time.Duration {
+	if timeout, ok := cfg.Timeouts[source]; ok {
+		return timeout
+	}
+	return cfg.Timeout
+}
+
+// backoff doubles HTTP_MIN_BACKOFF with every attempt up to HTTP_MAX_BACKOFF
+// and picks a random wait between half and all of it.
+func backoff(attempt int) time.Duration {
+	wait := HTTP_MIN_BACKOFF << uint(attempt)
+	if wait <= 0 || wait > HTTP_MAX_BACKOFF {
+		wait = HTTP_MAX_BACKOFF
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. It is 0 when the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
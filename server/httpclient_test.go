@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterBlocksTheSource(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewHTTPClient(server.Client())
+	v := venue{client: client}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.Get(ctx, "venue", server.URL); err == nil {
+		t.Fatal("the rate limited request succeeded")
+	}
+
+	// Neither the next request nor the next poll reaches the server.
+	if _, err := client.Get(ctx, "venue", server.URL); err == nil {
+		t.Fatal("the blocked request succeeded")
+	}
+	_, err := v.fetchSymbols(ctx, "venue", []string{"BTC", "ETH"}, func(ctx context.Context, symbol string) (Price, error) {
+		_, err := client.Get(ctx, "venue", server.URL)
+		return Price{}, err
+	})
+	if err == nil {
+		t.Fatal("the blocked poll succeeded")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	stats := client.Stats()["venue"]
+	if stats.Skipped != 2 {
+		t.Errorf("skipped %d requests, want 2", stats.Skipped)
+	}
+	if stats.BlockedUntil.Before(start.Add(59*time.Second)) || stats.BlockedUntil.After(time.Now().Add(60*time.Second)) {
+		t.Errorf("blocked until %s, want 60s after %s", stats.BlockedUntil, start)
+	}
+
+	// The other sources are not held off.
+	if _, ok := client.Stats()["other"]; ok {
+		t.Error("unexpected stats of another source")
+	}
+	if until, blocked := client.budget(defaultConfig(), "other").blocked(time.Now()); blocked {
+		t.Errorf("another source is blocked until %s", until)
+	}
+}
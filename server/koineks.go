@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	KOINEKS_URI = "https://api.thodex.com/v1/public/order-depth?market=%s%s&limit=%d"
+)
+
+var (
+	koineksCurrencies      = []string{"BTC", "ETH", "LTC", "BCH", "USDT", "ETC", "DOGE", "XRP", "XLM", "EOS", "XEM", "DASH"}
+	koineksCrossCurrencies = []string{"ETH", "LTC"}
+)
+
+type koineksExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return koineksExchange{v} })
+}
+
+func (koineksExchange) Name() string {
+	return KOINEKS
+}
+
+func (e koineksExchange) Currency() string {
+	return e.configuredCurrency(KOINEKS, "TRY")
+}
+
+func (e koineksExchange) Symbols() []string {
+	return e.configuredSymbols(KOINEKS, koineksCurrencies)
+}
+
+func (e koineksExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, e.Currency(), e.Symbols())
+}
+
+func (e koineksExchange) FetchCrossTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, "BTC", koineksCrossCurrencies)
+}
+
+// Koineks has no ticker endpoint, the top of the book is used instead.
+func (e koineksExchange) fetchTickers(ctx context.Context, quote string, symbols []string) ([]Price, error) {
+	return e.fetchSymbols(ctx, KOINEKS, symbols, func(ctx context.Context, id string) (Price, error) {
+		book, err := e.fetchOrderBook(ctx, id, quote, 1)
+		if err != nil {
+			return Price{}, err
+		}
+
+		if len(book.Asks) == 0 {
+			return Price{}, fmt.Errorf("failed to read the ask price from the Koineks response data: no asks for %s", id)
+		}
+		if len(book.Bids) == 0 {
+			return Price{}, fmt.Errorf("failed to read the bid price from the Koineks response data: no bids for %s", id)
+		}
+
+		return Price{Exchange: KOINEKS, Currency: quote, ID: id, Ask: book.Asks[0].Price, Bid: book.Bids[0].Price}, nil
+	})
+}
+
+func (e koineksExchange) FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error) {
+	return e.fetchOrderBook(ctx, symbol, e.Currency(), depth)
+}
+
+func (e koineksExchange) fetchOrderBook(ctx context.Context, symbol, quote string, depth int) (OrderBook, error) {
+	book := OrderBook{Exchange: KOINEKS, Currency: quote, ID: symbol}
+
+	responseData, err := e.httpGet(ctx, KOINEKS, fmt.Sprintf(KOINEKS_URI, symbol, quote, depth))
+	if err != nil {
+		return book, fmt.Errorf("failed to get Koineks response : %s", err)
+	}
+
+	book.Asks, err = parseOrderBookLevels(responseData, "[0]", "[1]", "result", "asks")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the asks from the Koineks response data: %s", err)
+	}
+
+	book.Bids, err = parseOrderBookLevels(responseData, "[0]", "[1]", "result", "bids")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the bids from the Koineks response data: %s", err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	KOINIM_URI = "http://koinim.com/api/v1/ticker/%s_%s/"
+)
+
+var (
+	koinimCurrencies      = []string{"BTC", "ETH", "LTC", "BCH", "DOGE", "DASH"}
+	koinimCrossCurrencies = []string{"LTC"}
+)
+
+type koinimExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return koinimExchange{v} })
+}
+
+func (koinimExchange) Name() string {
+	return KOINIM
+}
+
+func (e koinimExchange) Currency() string {
+	return e.configuredCurrency(KOINIM, "TRY")
+}
+
+func (e koinimExchange) Symbols() []string {
+	return e.configuredSymbols(KOINIM, koinimCurrencies)
+}
+
+func (e koinimExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, e.Currency(), e.Symbols())
+}
+
+func (e koinimExchange) FetchCrossTickers(ctx context.Context) ([]Price, error) {
+	return e.fetchTickers(ctx, "BTC", koinimCrossCurrencies)
+}
+
+func (e koinimExchange) fetchTickers(ctx context.Context, quote string, symbols []string) ([]Price, error) {
+	return e.fetchSymbols(ctx, KOINIM, symbols, func(ctx context.Context, id string) (Price, error) {
+		responseData, err := e.httpGet(ctx, KOINIM, fmt.Sprintf(KOINIM_URI, id, quote))
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to get Koinim response for %s: %s", id, err)
+		}
+
+		koinimPriceAsk, err := jsonparser.GetFloat(responseData, "ask")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the %s ask price from the Koinim response data: %s", id, err)
+		}
+
+		koinimPriceBid, err := jsonparser.GetFloat(responseData, "bid")
+		if err != nil {
+			return Price{}, fmt.Errorf("failed to read the %s bid price from the Koinim response data: %s", id, err)
+		}
+
+		return Price{Exchange: KOINIM, Currency: quote, ID: id, Ask: koinimPriceAsk, Bid: koinimPriceBid}, nil
+	})
+}
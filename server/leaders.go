@@ -0,0 +1,93 @@
+package server
+
+import (
+	"time"
+)
+
+var (
+	LEADER_HISTORY = 24 * time.Hour
+	// LEADER_CHANGES_LIMIT bounds the leader changes kept within
+	// LEADER_HISTORY, the oldest ones are dropped first.
+	LEADER_CHANGES_LIMIT = 10000
+	// LEADER_CHANGES_QUERY_LIMIT is the number of the latest changes the
+	// leaders endpoint returns by default.
+	LEADER_CHANGES_QUERY_LIMIT = 500
+)
+
+// Leader is the symbol of an exchange with the lowest ask diff, the cheapest
+// to buy, and the one with the highest bid diff, the richest to sell, both
+// relative to the reference price.
+type Leader struct {
+	Exchange  string    `json:"exchange"`
+	Buy       string    `json:"buy"`
+	BuyDiff   float64   `json:"buyDiff"`
+	Sell      string    `json:"sell"`
+	SellDiff  float64   `json:"sellDiff"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// LeaderChange records a new leader on one side of an exchange. Side is
+// "Buy" or "Sell".
+type LeaderChange struct {
+	Time     time.Time `json:"time"`
+	Exchange string    `json:"exchange"`
+	Side     string    `json:"side"`
+	Symbol   string    `json:"symbol"`
+	Diff     float64   `json:"diff"`
+}
+
+// updateLeaders keeps the min and max symbols of the diff calculation that
+// published m, before they are reset. The leader changes are kept for
+// LEADER_HISTORY, up to LEADER_CHANGES_LIMIT of them.
+func (s *Server) updateLeaders(m *MarketState, cfg *Config, now time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	current := map[string]Leader{}
+	for _, e := range s.activeExchanges(cfg) {
+		buy, sell := m.MinSymbol[e.Name()], m.MaxSymbol[e.Name()]
+		if buy == "" || sell == "" {
+			continue
+		}
+
+		leader := Leader{
+			Exchange:  e.Name(),
+			Buy:       buy,
+			BuyDiff:   m.MinDiffs[e.Name()],
+			Sell:      sell,
+			SellDiff:  m.MaxDiffs[e.Name()],
+			UpdatedAt: now,
+		}
+		current[e.Name()] = leader
+
+		previous := s.leaders[e.Name()]
+		if previous.Buy != leader.Buy {
+			s.leaderChanges = append(s.leaderChanges, LeaderChange{Time: now, Exchange: e.Name(), Side: "Buy", Symbol: leader.Buy, Diff: leader.BuyDiff})
+		}
+		if previous.Sell != leader.Sell {
+			s.leaderChanges = append(s.leaderChanges, LeaderChange{Time: now, Exchange: e.Name(), Side: "Sell", Symbol: leader.Sell, Diff: leader.SellDiff})
+		}
+	}
+	s.leaders = current
+
+	expired := 0
+	for expired < len(s.leaderChanges) && now.Sub(s.leaderChanges[expired].Time) > LEADER_HISTORY {
+		expired++
+	}
+	if len(s.leaderChanges)-expired > LEADER_CHANGES_LIMIT {
+		expired = len(s.leaderChanges) - LEADER_CHANGES_LIMIT
+	}
+	s.leaderChanges = s.leaderChanges[expired:]
+}
+
+// sortedLeaders lists the leaders in exchange order. It must be called with
+// mux held.
+func (s *Server) sortedLeaders(cfg *Config) []Leader {
+	var list []Leader
+	for _, e := range s.activeExchanges(cfg) {
+		if leader, ok := s.leaders[e.Name()]; ok {
+			list = append(list, leader)
+		}
+	}
+	return list
+}
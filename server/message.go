@@ -1,107 +1,148 @@
 package server
 
 import (
-	"bytes"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
 	"strings"
-	"time"
 )
 
-const (
-	PUSHOVER_URI = "https://api.pushover.net/1/messages.json"
-)
+// sendMessages evaluates the alert rules against the latest diffs, then the
+// pair and the triangle notifications, all on the same state and settings.
+func (s *Server) sendMessages(set *Settings) {
+	m := s.store.Snapshot()
+	now := s.clock.Now()
+	for _, rule := range s.activeRules(set.Config) {
+		if rule.isActive(now) {
+			s.notifyChannels(set, ALERT_FIAT, rule.Channels, s.ruleMessages(m, set.Config, rule))
+		}
+	}
+
+	if set.Config.Notification.PairEnabled {
+		s.notify(set, ALERT_PAIR, s.pairMessages(m, set.Config))
+	}
+	s.notify(set, ALERT_TRIANGLE, s.triangleMessages(m, set.Config))
+}
 
-var (
-	notificationFlags  map[string]bool
-	notificationTimes  map[string]time.Time
-	PUSHOVER_USER      = ""
-	PUSHOVER_APP_TOKEN = ""
+// ruleMessages returns the lines of the exchanges and symbols of the rule
+// that crossed its threshold since they were last notified. The threshold of
+// an ask rule is lowered by the spread of the reference.
+func (s *Server) ruleMessages(m *MarketState, cfg *Config, rule AlertRule) string {
+	exchanges, symbols := rule.Exchanges, rule.Symbols
+	if len(exchanges) == 0 {
+		exchanges = cfg.Notification.Exchanges
+	}
+	if len(symbols) == 0 {
+		symbols = m.Symbols
+	}
 
-	MIN_NOTI_PERC  = -2.0
-	MAX_NOTI_PERC  = 3.25
-	PAIR_THRESHOLD = 1.0
-	DURATION       = 10.0
-)
+	side := "Ask"
+	if rule.Side == RULE_BID {
+		side = "Bid"
+	}
 
-func sendMessages() {
 	var out string
-	if fiatNotificationEnabled {
-		for _, exchange := range ALL_EXCHANGES {
-			if exchange == PARIBU || exchange == BTCTURK {
+	for _, exchange := range exchanges {
+		for _, symbol := range symbols {
+			exchangeSymbol := fmt.Sprintf("%s-%s", exchange, symbol)
+			key := fmt.Sprintf("%s|%s", rule.ID, exchangeSymbol)
+
+			reference, ok := m.CoinbaseProPrices[symbol]
+			if !ok {
+				continue
+			}
+			firstExchange := reference.Exchange
+			spread := m.Spreads[fmt.Sprintf("%s%s", firstExchange, symbol)]
+
+			rawAskDiff := m.Diffs[fmt.Sprintf("%s-%s-%s", firstExchange, exchangeSymbol, "Ask")]
+			rawBidDiff := m.Diffs[fmt.Sprintf("%s-%s-%s", firstExchange, exchangeSymbol, "Bid")]
+			rawDiff := m.Diffs[fmt.Sprintf("%s-%s-%s", firstExchange, exchangeSymbol, side)]
+			diff, listed := m.NetDiffs[fmt.Sprintf("%s-%s-%s", firstExchange, exchangeSymbol, side)]
+			price := m.Prices[fmt.Sprintf("%s-%s", exchangeSymbol, side)]
+			stale := m.StaleQuotes[exchangeSymbol] || m.StaleQuotes[fmt.Sprintf("%s-%s", firstExchange, symbol)]
+
+			if !listed || stale || rawBidDiff > rawAskDiff {
 				continue
 			}
 
-			for _, symbol := range ALL_SYMBOLS {
-				exchangeSymbol := fmt.Sprintf("%s-%s", exchange, symbol)
-
-				notificationFlag := notificationFlags[exchangeSymbol]
-				notificationTime := notificationTimes[exchangeSymbol]
-				duration := time.Since(notificationTime)
-
-				commissionFee := 0.0
-				firstExchange := GDAX
-				if symbol == "USDT" || symbol == "DOGE" || symbol == "XEM"{
-					firstExchange = BINANCE
-					commissionFee = 0.1
-				}
-				mux.Lock()
-				spread := spreads[fmt.Sprintf("%s%s", firstExchange, symbol)]
-
-				exchangeSymbolAsk := fmt.Sprintf("%s-%s", exchangeSymbol, "Ask")
-				exchangeSymbolBid := fmt.Sprintf("%s-%s", exchangeSymbol, "Bid")
-				askDiff := diffs[fmt.Sprintf("%s-%s", firstExchange, exchangeSymbolAsk)]
-				bidDiff := diffs[fmt.Sprintf("%s-%s", firstExchange, exchangeSymbolBid)]
-				mux.Unlock()
-
-				if bidDiff > askDiff {
-					continue
-				}
-
-				if notificationFlag && askDiff > MIN_NOTI_PERC-commissionFee - spread && bidDiff < MAX_NOTI_PERC+commissionFee {
-					notificationFlags[exchangeSymbol] = false
-				}
-
-				if !notificationFlag && duration.Minutes() >= DURATION &&
-					(askDiff <= MIN_NOTI_PERC-commissionFee - spread || bidDiff >= MAX_NOTI_PERC+commissionFee) {
-					notificationFlags[exchangeSymbol] = true
-					notificationTimes[exchangeSymbol] = time.Now()
-
-					if askDiff <= MIN_NOTI_PERC {
-						askPrice := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", prices[exchangeSymbolAsk]), "0"), ".")
-						out += fmt.Sprintf("%s %s %%%.2f %s\n", exchange, symbol, askDiff, askPrice)
-					} else {
-						bidPrice := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", prices[exchangeSymbolBid]), "0"), ".")
-						out += fmt.Sprintf("%s %s %%%.2f %s\n", exchange, symbol, bidDiff, bidPrice)
-					}
-				}
+			triggered := diff >= rule.Threshold
+			if rule.Side == RULE_ASK {
+				triggered = diff <= rule.Threshold-spread
+			}
+
+			if s.notificationFlags[key] && !triggered {
+				s.notificationFlags[key] = false
+			}
+
+			if !s.notificationFlags[key] && s.clock.Now().Sub(s.notificationTimes[key]).Minutes() >= rule.Cooldown && triggered {
+				s.notificationFlags[key] = true
+				s.notificationTimes[key] = s.clock.Now()
+
+				formattedPrice := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", price), "0"), ".")
+				out += fmt.Sprintf("%s %s net %%%.2f raw %%%.2f %s\n", exchange, symbol, diff, rawDiff, formattedPrice)
 			}
 		}
 	}
 
-	sendPushoverMessage(out)
+	if out != "" && rule.Owner != GLOBAL_RULE_OWNER {
+		out = fmt.Sprintf("%s\n%s", rule.Owner, out)
+	}
+	return out
 }
 
-func sendPushoverMessage(message string) {
-	if message == "" {
-		return
-	}
+// pairMessages notifies the notified venues whose direct spread with another
+// one of them exceeds the pair threshold, with the same cooldown as the fiat
+// notifications.
+func (s *Server) pairMessages(m *MarketState, cfg *Config) string {
+	s.mux.Lock()
+	list := s.findPairSpreads(m, cfg, cfg.Notification.Exchanges, s.clock.Now())
+	s.mux.Unlock()
 
-	// POST
-	form := url.Values{
-		"user":    {PUSHOVER_USER},
-		"token":   {PUSHOVER_APP_TOKEN},
-		"message": {message},
-	}
+	threshold, duration := cfg.Notification.PairThreshold, cfg.Notification.Duration
+	var out string
+	for _, spread := range list {
+		key := fmt.Sprintf("%s-%s-%s", spread.Buy, spread.Sell, spread.Symbol)
+		if s.notificationFlags[key] && spread.Net < threshold {
+			s.notificationFlags[key] = false
+		}
+
+		if !s.notificationFlags[key] && s.clock.Now().Sub(s.notificationTimes[key]).Minutes() >= duration && spread.Net >= threshold {
+			s.notificationFlags[key] = true
+			s.notificationTimes[key] = s.clock.Now()
 
-	body := bytes.NewBufferString(form.Encode())
-	_, err := http.Post(PUSHOVER_URI, "application/x-www-form-urlencoded", body)
-	if err != nil {
-		fmt.Println("Failed to send the message to pushover : ", err)
-		log.Println("Failed to send the message to pushover : ", err)
+			askPrice := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", spread.BuyAsk), "0"), ".")
+			bidPrice := strings.TrimRight(strings.TrimRight(fmt.Sprintf("%f", spread.SellBid), "0"), ".")
+			out += fmt.Sprintf("%s %s buy %s %s sell %s %s net %%%.2f raw %%%.2f\n", spread.Symbol, spread.Currency,
+				spread.Buy, askPrice, spread.Sell, bidPrice, spread.Net, spread.Raw)
+		}
 	}
+	return out
+}
 
-	log.Println("Sent message ", message)
+// triangleMessages notifies the cycles of the notified exchanges returning
+// more than the triangle threshold, with the same cooldown as the pairs.
+func (s *Server) triangleMessages(m *MarketState, cfg *Config) string {
+	list := s.sortedTriangles(m, cfg)
+
+	threshold, duration := cfg.Notification.Triangle, cfg.Notification.Duration
+	var out string
+	for _, t := range list {
+		if !containsSymbol(cfg.Notification.Exchanges, t.Exchange) {
+			continue
+		}
+
+		cycles := map[string]float64{"Forward": t.Forward, "Reverse": t.Reverse}
+		for _, direction := range []string{"Forward", "Reverse"} {
+			key := fmt.Sprintf("%s-%s-%s", t.Exchange, t.Symbol, direction)
+			if s.notificationFlags[key] && cycles[direction] < threshold {
+				s.notificationFlags[key] = false
+			}
+
+			if !s.notificationFlags[key] && s.clock.Now().Sub(s.notificationTimes[key]).Minutes() >= duration &&
+				cycles[direction] >= threshold {
+				s.notificationFlags[key] = true
+				s.notificationTimes[key] = s.clock.Now()
+				out += fmt.Sprintf("%s %s %s cycle %s %%%.2f\n", t.Exchange, t.Currency, t.Symbol, strings.ToLower(direction), cycles[direction])
+			}
+		}
+	}
+	return out
 }
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NOTIFIER_PUSHOVER = "pushover"
+	NOTIFIER_TELEGRAM = "telegram"
+	NOTIFIER_SLACK    = "slack"
+	NOTIFIER_WEBHOOK  = "webhook"
+	NOTIFIER_SMTP     = "smtp"
+
+	PUSHOVER_URI = "https://api.pushover.net/1/messages.json"
+	TELEGRAM_URI = "https://api.telegram.org"
+
+	// The alerts that are routed to the notification channels.
+	ALERT_DEFAULT  = "default"
+	ALERT_FIAT     = "fiat"
+	ALERT_PAIR     = "pair"
+	ALERT_TRIANGLE = "triangle"
+	ALERT_FX       = "fx"
+)
+
+var (
+	NOTIFY_TIMEOUT     = 10 * time.Second
+	NOTIFY_RETRIES     = 3
+	NOTIFY_RETRY_DELAY = 2 * time.Second
+
+	ALERTS = []string{ALERT_DEFAULT, ALERT_FIAT, ALERT_PAIR, ALERT_TRIANGLE, ALERT_FX}
+)
+
+// Notification is a message of one alert.
+type Notification struct {
+	Alert   string    `json:"alert"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Notifier delivers notifications to a channel. An error is returned when
+// the channel did not accept the notification, it is then retried.
+type Notifier interface {
+	Type() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// newNotifier builds the notifier of a config entry. The HTTP channels post
+// with client, http.DefaultClient when it is nil.
+func newNotifier(cfg NotifierConfig, client *http.Client) (Notifier, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	switch cfg.Type {
+	case NOTIFIER_PUSHOVER:
+		if cfg.User == "" || cfg.Token == "" {
+			return nil, fmt.Errorf("pushover needs a user and a token")
+		}
+		return pushoverNotifier{client: client, uri: withDefault(cfg.URL, PUSHOVER_URI), user: cfg.User, token: cfg.Token}, nil
+	case NOTIFIER_TELEGRAM:
+		if cfg.Token == "" || cfg.ChatID == "" {
+			return nil, fmt.Errorf("telegram needs a bot token and a chat id")
+		}
+		return telegramNotifier{client: client, uri: withDefault(cfg.URL, TELEGRAM_URI), token: cfg.Token, chatID: cfg.ChatID}, nil
+	case NOTIFIER_SLACK, NOTIFIER_WEBHOOK:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s needs a url", cfg.Type)
+		}
+		return webhookNotifier{client: client, kind: cfg.Type, uri: cfg.URL}, nil
+	case NOTIFIER_SMTP:
+		if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("smtp needs a host, a sender and recipients")
+		}
+		return smtpNotifier{host: cfg.Host, port: cfg.Port, username: cfg.Username, password: cfg.Password, from: cfg.From, to: cfg.To}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+}
+
+func withDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// notify sends the message to the channels of the alert, or to the default
+// channels when the alert has none.
+func (s *Server) notify(set *Settings, alert, message string) {
+	s.notifyChannels(set, alert, nil, message)
+}
+
+// notifyChannels sends the message to the given notifiers of set, or to the
+// ones of the alert when there are none. Every channel is delivered to in
+// the background and retried on its own.
+func (s *Server) notifyChannels(set *Settings, alert string, channels []string, message string) {
+	if message == "" {
+		return
+	}
+
+	if len(channels) == 0 {
+		var ok bool
+		if channels, ok = set.Channels[alert]; !ok {
+			channels = set.Channels[ALERT_DEFAULT]
+		}
+	}
+	targets := map[string]Notifier{}
+	for _, name := range channels {
+		if n, ok := set.Notifiers[name]; ok {
+			targets[name] = n
+		}
+	}
+
+	n := Notification{Alert: alert, Message: message, Time: s.clock.Now()}
+	ctx := s.deliveryCtx
+	for name, notifier := range targets {
+		s.deliveries.Add(1)
+		go func(name string, notifier Notifier) {
+			defer s.deliveries.Done()
+			deliver(ctx, name, notifier, n)
+		}(name, notifier)
+	}
+}
+
+// deliver tries the notifier up to NOTIFY_RETRIES times, doubling the delay
+// between the attempts. A notification the channel refused is not retried,
+// and the retries end with ctx.
+func deliver(ctx context.Context, name string, notifier Notifier, n Notification) error {
+	delay := NOTIFY_RETRY_DELAY
+	var err error
+	for attempt := 1; attempt <= NOTIFY_RETRIES; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, NOTIFY_TIMEOUT)
+		err = notifier.Notify(attemptCtx, n)
+		cancel()
+
+		if err == nil {
+			log.Printf("Sent the %s notification via %s (%s) on attempt %d : %s\n", n.Alert, name, notifier.Type(), attempt, n.Message)
+			return nil
+		}
+
+		fmt.Printf("Failed to send the %s notification via %s on attempt %d : %s\n", n.Alert, name, attempt, err)
+		log.Printf("Failed to send the %s notification via %s on attempt %d : %s\n", n.Alert, name, attempt, err)
+		if permanent(err) || attempt == NOTIFY_RETRIES {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s, gave up retrying : %s", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// statusError is the answer of a channel that did not take a notification.
+type statusError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status %s : %s", e.status, e.body)
+}
+
+// permanent tells if sending the notification again cannot help: the channel
+// refused it with a 4xx other than 429, or a 5xx SMTP reply.
+func permanent(err error) bool {
+	switch e := err.(type) {
+	case statusError:
+		return e.code >= 400 && e.code < 500 && e.code != http.StatusTooManyRequests
+	case *textproto.Error:
+		return e.Code >= 500
+	}
+	return false
+}
+
+// postNotification sends the body and fails on a response other than 2xx.
+func postNotification(ctx context.Context, client *http.Client, uri, contentType string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	responseData, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return statusError{code: response.StatusCode, status: response.Status, body: strings.TrimSpace(string(responseData))}
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, uri string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postNotification(ctx, client, uri, "application/json", body)
+}
+
+type pushoverNotifier struct {
+	client           *http.Client
+	uri, user, token string
+}
+
+func (pushoverNotifier) Type() string {
+	return NOTIFIER_PUSHOVER
+}
+
+func (p pushoverNotifier) Notify(ctx context.Context, n Notification) error {
+	form := url.Values{
+		"user":    {p.user},
+		"token":   {p.token},
+		"message": {n.Message},
+	}
+	return postNotification(ctx, p.client, p.uri, "application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+type telegramNotifier struct {
+	client             *http.Client
+	uri, token, chatID string
+}
+
+func (telegramNotifier) Type() string {
+	return NOTIFIER_TELEGRAM
+}
+
+func (t telegramNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, t.client, fmt.Sprintf("%s/bot%s/sendMessage", t.uri, t.token), map[string]string{
+		"chat_id": t.chatID,
+		"text":    n.Message,
+	})
+}
+
+// webhookNotifier posts the notification as JSON. Slack incoming webhooks
+// only read the text field.
+type webhookNotifier struct {
+	client    *http.Client
+	kind, uri string
+}
+
+func (w webhookNotifier) Type() string {
+	return w.kind
+}
+
+func (w webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	if w.kind == NOTIFIER_SLACK {
+		return postJSON(ctx, w.client, w.uri, map[string]string{"text": n.Message})
+	}
+	return postJSON(ctx, w.client, w.uri, n)
+}
+
+type smtpNotifier struct {
+	host               string
+	port               int
+	username, password string
+	from               string
+	to                 []string
+}
+
+func (smtpNotifier) Type() string {
+	return NOTIFIER_SMTP
+}
+
+// Notify upgrades the connection with STARTTLS when the server offers it and
+// only authenticates when a username is configured.
+func (s smtpNotifier) Notify(ctx context.Context, n Notification) error {
+	port := s.port
+	if port == 0 {
+		port = 587
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(s.host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	subject := fmt.Sprintf("Crypto arbitrage %s alert", n.Alert)
+	fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), subject, n.Time.Format(time.RFC1123Z), strings.Replace(n.Message, "\n", "\r\n", -1))
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
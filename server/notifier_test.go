@@ -0,0 +1,360 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// request is what a stand-in channel received.
+type request struct {
+	path        string
+	contentType string
+	body        []byte
+}
+
+// channelServer answers the requests with the given statuses in turn, the
+// last one repeating, and records them.
+func channelServer(t *testing.T, statuses ...int) (*httptest.Server, func() []request) {
+	var (
+		mu       sync.Mutex
+		requests []request
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: body})
+		status := statuses[len(statuses)-1]
+		if len(requests) <= len(statuses) {
+			status = statuses[len(requests)-1]
+		}
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+func testNotification() Notification {
+	return Notification{Alert: ALERT_FIAT, Message: "Paribu BTC net %3.40", Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func TestNotifierPayloads(t *testing.T) {
+	n := testNotification()
+
+	// The URL of every config is a path, the address of the stand-in is put
+	// in front of it.
+	tests := []struct {
+		name        string
+		config      NotifierConfig
+		path        string
+		contentType string
+		check       func(t *testing.T, body []byte)
+	}{
+		{
+			name:        NOTIFIER_TELEGRAM,
+			config:      NotifierConfig{Type: NOTIFIER_TELEGRAM, Token: "123:abc", ChatID: "42"},
+			path:        "/bot123:abc/sendMessage",
+			contentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				var payload map[string]string
+				if err := json.Unmarshal(body, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if payload["chat_id"] != "42" || payload["text"] != n.Message {
+					t.Errorf("unexpected payload %v", payload)
+				}
+			},
+		},
+		{
+			name:        NOTIFIER_SLACK,
+			config:      NotifierConfig{Type: NOTIFIER_SLACK, URL: "/services/hook"},
+			path:        "/services/hook",
+			contentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				var payload map[string]string
+				if err := json.Unmarshal(body, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if len(payload) != 1 || payload["text"] != n.Message {
+					t.Errorf("unexpected payload %v", payload)
+				}
+			},
+		},
+		{
+			name:        NOTIFIER_WEBHOOK,
+			config:      NotifierConfig{Type: NOTIFIER_WEBHOOK, URL: "/alerts"},
+			path:        "/alerts",
+			contentType: "application/json",
+			check: func(t *testing.T, body []byte) {
+				var payload Notification
+				if err := json.Unmarshal(body, &payload); err != nil {
+					t.Fatal(err)
+				}
+				if payload.Alert != n.Alert || payload.Message != n.Message || !payload.Time.Equal(n.Time) {
+					t.Errorf("unexpected payload %+v", payload)
+				}
+			},
+		},
+		{
+			name:        NOTIFIER_PUSHOVER,
+			config:      NotifierConfig{Type: NOTIFIER_PUSHOVER, URL: "/1/messages.json", User: "user", Token: "token"},
+			path:        "/1/messages.json",
+			contentType: "application/x-www-form-urlencoded",
+			check: func(t *testing.T, body []byte) {
+				form, err := url.ParseQuery(string(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if form.Get("user") != "user" || form.Get("token") != "token" || form.Get("message") != n.Message {
+					t.Errorf("unexpected form %v", form)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := channelServer(t, http.StatusOK)
+
+			config := test.config
+			config.URL = server.URL + config.URL
+			notifier, err := newNotifier(config, server.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notifier.Type() != test.name {
+				t.Errorf("type is %s, want %s", notifier.Type(), test.name)
+			}
+			if err := notifier.Notify(context.Background(), n); err != nil {
+				t.Fatal(err)
+			}
+
+			list := requests()
+			if len(list) != 1 {
+				t.Fatalf("got %d requests, want 1", len(list))
+			}
+			if list[0].path != test.path {
+				t.Errorf("path is %s, want %s", list[0].path, test.path)
+			}
+			if list[0].contentType != test.contentType {
+				t.Errorf("content type is %s, want %s", list[0].contentType, test.contentType)
+			}
+			test.check(t, list[0].body)
+		})
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	defer func(delay time.Duration) { NOTIFY_RETRY_DELAY = delay }(NOTIFY_RETRY_DELAY)
+	NOTIFY_RETRY_DELAY = time.Millisecond
+
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		fails    bool
+	}{
+		{name: "server error", statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, requests: 3},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, requests: 2},
+		{name: "gives up", statuses: []int{http.StatusInternalServerError}, requests: NOTIFY_RETRIES, fails: true},
+		{name: "refused", statuses: []int{http.StatusBadRequest, http.StatusOK}, requests: 1, fails: true},
+		{name: "unauthorized", statuses: []int{http.StatusUnauthorized, http.StatusOK}, requests: 1, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := channelServer(t, test.statuses...)
+			notifier := webhookNotifier{client: server.Client(), kind: NOTIFIER_WEBHOOK, uri: server.URL}
+
+			err := deliver(context.Background(), "hook", notifier, testNotification())
+			if (err != nil) != test.fails {
+				t.Errorf("error is %v, want failure %t", err, test.fails)
+			}
+			if got := len(requests()); got != test.requests {
+				t.Errorf("got %d requests, want %d", got, test.requests)
+			}
+		})
+	}
+}
+
+func TestDeliverStopsRetryingWithContext(t *testing.T) {
+	defer func(delay time.Duration) { NOTIFY_RETRY_DELAY = delay }(NOTIFY_RETRY_DELAY)
+	NOTIFY_RETRY_DELAY = time.Minute
+
+	server, requests := channelServer(t, http.StatusServiceUnavailable)
+	notifier := webhookNotifier{client: server.Client(), kind: NOTIFIER_WEBHOOK, uri: server.URL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := deliver(ctx, "hook", notifier, testNotification()); err == nil {
+		t.Fatal("delivery succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("delivery took %s after the context ended", elapsed)
+	}
+	if got := len(requests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+// smtpServer is a plain SMTP stand-in accepting one session. rcptReply is
+// the reply to RCPT TO.
+type smtpServer struct {
+	listener  net.Listener
+	rcptReply string
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPServer(t *testing.T, rcptReply string) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, rcptReply: rcptReply, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			reply(s.rcptReply)
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data []string
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				line = strings.TrimRight(line, "\r\n")
+				if line == "." {
+					break
+				}
+				data = append(data, line)
+			}
+			s.mu.Lock()
+			s.data = strings.Join(data, "\n")
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) wait(t *testing.T) {
+	select {
+	case <-s.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the SMTP session did not end")
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	server := newSMTPServer(t, "250 OK")
+	notifier, err := newNotifier(NotifierConfig{Type: NOTIFIER_SMTP, Host: "127.0.0.1", Port: server.port(),
+		From: "alerts@example.com", To: []string{"a@example.com", "b@example.com"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := testNotification()
+	n.Message = "Paribu BTC net %3.40\nBTCTurk ETH net %3.10"
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := notifier.Notify(ctx, n); err != nil {
+		t.Fatal(err)
+	}
+	server.wait(t)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	envelope := strings.Join(server.commands, "\n")
+	for _, command := range []string{"MAIL FROM:<alerts@example.com>", "RCPT TO:<a@example.com>", "RCPT TO:<b@example.com>", "QUIT"} {
+		if !strings.Contains(envelope, command) {
+			t.Errorf("%q was not sent, got %q", command, envelope)
+		}
+	}
+	for _, line := range []string{"From: alerts@example.com", "To: a@example.com, b@example.com",
+		"Subject: Crypto arbitrage fiat alert", "Paribu BTC net %3.40", "BTCTurk ETH net %3.10"} {
+		if !strings.Contains(server.data, line) {
+			t.Errorf("%q is not in the message %q", line, server.data)
+		}
+	}
+}
+
+func TestSMTPRejectionIsNotRetried(t *testing.T) {
+	server := newSMTPServer(t, "550 No such user")
+	notifier := smtpNotifier{host: "127.0.0.1", port: server.port(), from: "alerts@example.com", to: []string{"nobody@example.com"}}
+
+	// A retry would block on the listener, which accepts one session.
+	err := deliver(context.Background(), "mail", notifier, testNotification())
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("error is %v, want the 550 reply", err)
+	}
+	server.wait(t)
+}
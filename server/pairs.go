@@ -0,0 +1,216 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PairSpread is the return of buying a symbol at the ask of one venue and
+// selling it at the bid of another, both quoted in Currency. Raw and Net are
+// in percent, Net after the fees of the round trip.
+type PairSpread struct {
+	Symbol   string  `json:"symbol"`
+	Currency string  `json:"currency"`
+	Buy      string  `json:"buy"`
+	Sell     string  `json:"sell"`
+	BuyAsk   float64 `json:"buyAsk"`
+	SellBid  float64 `json:"sellBid"`
+	Raw      float64 `json:"raw"`
+	Net      float64 `json:"net"`
+}
+
+// findPairSpreads compares every two venues of the given exchanges in m
+// directly, without the reference price or an FX rate. Stale quotes are left
+// out. It must be called with mux held.
+func (s *Server) findPairSpreads(m *MarketState, cfg *Config, list []string, now time.Time) []PairSpread {
+	var spreads []PairSpread
+	for _, buyExchange := range list {
+		for _, sellExchange := range list {
+			if buyExchange == sellExchange {
+				continue
+			}
+
+			for _, buy := range m.ExchangePrices[buyExchange] {
+				sell, ok := findPrice(m.ExchangePrices[sellExchange], buy.ID)
+				if !ok || sell.Currency != buy.Currency || s.isStale(cfg, buy, now) || s.isStale(cfg, sell, now) {
+					continue
+				}
+
+				if spread, ok := s.pairSpread(cfg, buy, sell); ok {
+					spreads = append(spreads, spread)
+				}
+			}
+		}
+	}
+	return spreads
+}
+
+// pairSpread must be called with mux held.
+func (s *Server) pairSpread(cfg *Config, buy, sell Price) (PairSpread, bool) {
+	if buy.Ask <= 0 || sell.Bid <= 0 {
+		return PairSpread{}, false
+	}
+
+	_, net := calculateNetDiffs(cfg, buy.Exchange, buy.Ask, sell, s.tradeNotional(buy.Currency))
+	return PairSpread{
+		Symbol:   buy.ID,
+		Currency: buy.Currency,
+		Buy:      buy.Exchange,
+		Sell:     sell.Exchange,
+		BuyAsk:   buy.Ask,
+		SellBid:  sell.Bid,
+		Raw:      Round((sell.Bid-buy.Ask)*100/buy.Ask, .5, 2),
+		Net:      net,
+	}, true
+}
+
+func findPrice(list []Price, symbol string) (Price, bool) {
+	for _, p := range list {
+		if p.ID == symbol {
+			return p, true
+		}
+	}
+	return Price{}, false
+}
+
+// SpreadMatrix holds the pair spreads of one symbol between every two venues
+// quoting it. Cells[i][j] buys on Exchanges[i] and sells on Exchanges[j], it
+// is nil on the diagonal and when a rate is missing. Quotes in another
+// currency are converted with the USD rates.
+type SpreadMatrix struct {
+	Symbol    string          `json:"symbol"`
+	Currency  string          `json:"currency"`
+	Exchanges []string        `json:"exchanges"`
+	Cells     [][]*PairSpread `json:"cells"`
+	Best      *PairSpread     `json:"best,omitempty"`
+}
+
+// spreadMatrices builds a matrix per symbol from the fresh quotes in m of the
+// venues in currency, or of every venue when currency is empty. A matrix
+// mixing currencies is expressed in USD. It must be called with mux held.
+func (s *Server) spreadMatrices(m *MarketState, cfg *Config, currency string, now time.Time) []SpreadMatrix {
+	var venues []Exchange
+	for _, e := range s.activeExchanges(cfg) {
+		if currency == "" || e.Currency() == currency {
+			venues = append(venues, e)
+		}
+	}
+
+	var matrices []SpreadMatrix
+	for _, symbol := range m.Symbols {
+		var quotes []Price
+		for _, e := range venues {
+			if p, ok := findPrice(m.ExchangePrices[e.Name()], symbol); ok && !s.isStale(cfg, p, now) {
+				quotes = append(quotes, p)
+			}
+		}
+		if len(quotes) < 2 {
+			continue
+		}
+
+		matrix := SpreadMatrix{Symbol: symbol, Currency: quotes[0].Currency}
+		for _, p := range quotes {
+			matrix.Exchanges = append(matrix.Exchanges, p.Exchange)
+			if p.Currency != matrix.Currency {
+				matrix.Currency = "USD"
+			}
+		}
+
+		for _, buy := range quotes {
+			row := make([]*PairSpread, len(quotes))
+			for j, sell := range quotes {
+				if buy.Exchange == sell.Exchange {
+					continue
+				}
+
+				convertedBuy, ok := s.convertPrice(buy, matrix.Currency)
+				if !ok {
+					continue
+				}
+				convertedSell, ok := s.convertPrice(sell, matrix.Currency)
+				if !ok {
+					continue
+				}
+
+				spread, ok := s.pairSpread(cfg, convertedBuy, convertedSell)
+				if !ok {
+					continue
+				}
+				row[j] = &spread
+				if matrix.Best == nil || spread.Net > matrix.Best.Net {
+					matrix.Best = &spread
+				}
+			}
+			matrix.Cells = append(matrix.Cells, row)
+		}
+		matrices = append(matrices, matrix)
+	}
+	return matrices
+}
+
+// convertPrice expresses p in currency through the USD rates. It must be
+// called with mux held.
+func (s *Server) convertPrice(p Price, currency string) (Price, bool) {
+	if p.Currency == currency {
+		return p, true
+	}
+
+	from, to := s.usdRate(p.Currency), s.usdRate(currency)
+	if from == 0 || to == 0 {
+		return p, false
+	}
+	p.Ask = p.Ask * to / from
+	p.Bid = p.Bid * to / from
+	p.Currency = currency
+	return p, true
+}
+
+type matrixCell struct {
+	Spread *PairSpread
+	Best   bool
+}
+
+type matrixRow struct {
+	Exchange string
+	Cells    []matrixCell
+}
+
+type matrixView struct {
+	SpreadMatrix
+	Rows []matrixRow
+}
+
+// PrintSpreadMatrix renders the matrices of the dashboard with the best
+// route of every symbol highlighted. The currency query parameter limits
+// them to the venues of one currency.
+func (s *Server) PrintSpreadMatrix(c *gin.Context) {
+	currency := strings.ToUpper(c.Query("currency"))
+	cfg := s.currentConfig()
+	m := s.store.Snapshot()
+
+	s.mux.Lock()
+	matrices := s.spreadMatrices(m, cfg, currency, s.clock.Now())
+	s.mux.Unlock()
+
+	var views []matrixView
+	for _, matrix := range matrices {
+		view := matrixView{SpreadMatrix: matrix}
+		for i, exchange := range matrix.Exchanges {
+			row := matrixRow{Exchange: exchange}
+			for _, spread := range matrix.Cells[i] {
+				row.Cells = append(row.Cells, matrixCell{Spread: spread, Best: spread != nil && spread == matrix.Best})
+			}
+			view.Rows = append(view.Rows, row)
+		}
+		views = append(views, view)
+	}
+
+	c.HTML(http.StatusOK, "matrix.tmpl", gin.H{
+		"Currency":   currency,
+		"Currencies": s.fxCurrencies(cfg),
+		"Matrices":   views,
+	})
+}
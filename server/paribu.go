@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	PARIBU_URI = "https://www.paribu.com/ticker"
+	// The market page lists the book as price to amount objects.
+	PARIBU_ORDERBOOK_URI = "https://v3.paribu.com/app/markets/%s-%s?interval=1000"
+)
+
+var (
+	paribuCurrencies = []string{"BTC", "ETH", "LTC", "BCH", "DOGE", "XRP", "XLM", "EOS", "USDT", "LINK"}
+)
+
+type paribuExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return paribuExchange{v} })
+}
+
+func (paribuExchange) Name() string {
+	return PARIBU
+}
+
+func (e paribuExchange) Currency() string {
+	return e.configuredCurrency(PARIBU, "TRY")
+}
+
+// paribuQuote returns the code Paribu lists the quote currency under.
+func paribuQuote(currency string) string {
+	if currency == "TRY" {
+		return "TL"
+	}
+	return currency
+}
+
+func (e paribuExchange) Symbols() []string {
+	return e.configuredSymbols(PARIBU, paribuCurrencies)
+}
+
+func (e paribuExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	var prices []Price
+	quote := e.Currency()
+
+	responseData, err := e.httpGet(ctx, PARIBU, PARIBU_URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Paribu response : %s", err)
+	}
+
+	for _, id := range e.Symbols() {
+		pair := fmt.Sprintf("%s_%s", id, paribuQuote(quote))
+		priceAsk, err := jsonparser.GetFloat(responseData, pair, "lowestAsk")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the ask price from the Paribu response data: %s", err)
+		}
+
+		priceBid, err := jsonparser.GetFloat(responseData, pair, "highestBid")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the bid price from the Paribu response data: %s", err)
+		}
+
+		prices = append(prices, Price{Exchange: PARIBU, Currency: quote, ID: id, Ask: priceAsk, Bid: priceBid})
+	}
+	return prices, nil
+}
+
+func (e paribuExchange) FetchOrderBook(ctx context.Context, symbol string, depth int) (OrderBook, error) {
+	book := OrderBook{Exchange: PARIBU, Currency: e.Currency(), ID: symbol}
+
+	responseData, err := e.httpGet(ctx, PARIBU, fmt.Sprintf(PARIBU_ORDERBOOK_URI, strings.ToLower(symbol), strings.ToLower(paribuQuote(book.Currency))))
+	if err != nil {
+		return book, fmt.Errorf("failed to get Paribu order book response : %s", err)
+	}
+
+	book.Asks, err = parseOrderBookMap(responseData, false, depth, "data", "orderBook", "sell")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the %s asks from the Paribu response data: %s", symbol, err)
+	}
+
+	book.Bids, err = parseOrderBookMap(responseData, true, depth, "data", "orderBook", "buy")
+	if err != nil {
+		return book, fmt.Errorf("failed to read the %s bids from the Paribu response data: %s", symbol, err)
+	}
+
+	return book, nil
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RULE_ASK = "ask"
+	RULE_BID = "bid"
+
+	GLOBAL_RULE_OWNER = "global"
+)
+
+// AlertRule notifies its owner when the net diff of one of its exchanges and
+// symbols against the reference crosses Threshold. An ask rule fires when the
+// ask diff is at or below it, a bid rule when the bid diff is at or above it.
+// Empty Exchanges and Symbols match the notified exchanges and every symbol,
+// empty Channels use the channels of the fiat alert. Cooldown is in minutes.
+type AlertRule struct {
+	ID          string       `json:"id"`
+	Owner       string       `json:"owner"`
+	Exchanges   []string     `json:"exchanges,omitempty"`
+	Symbols     []string     `json:"symbols,omitempty"`
+	Side        string       `json:"side"`
+	Threshold   float64      `json:"threshold"`
+	Cooldown    float64      `json:"cooldown"`
+	Channels    []string     `json:"channels,omitempty"`
+	ActiveHours *ActiveHours `json:"activeHours,omitempty"`
+}
+
+// ActiveHours limits a rule to a daily time window, "15:04" formatted. A
+// window whose end is before its start spans midnight. Timezone is an IANA
+// name and defaults to UTC.
+type ActiveHours struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// validate checks the rule against the given settings and exchanges.
+func (r AlertRule) validate(set *Settings, exchanges []Exchange) error {
+	if r.Owner == "" {
+		return fmt.Errorf("the rule has no owner")
+	}
+	if r.Side != RULE_ASK && r.Side != RULE_BID {
+		return fmt.Errorf("side must be %q or %q", RULE_ASK, RULE_BID)
+	}
+	if r.Cooldown < 0 {
+		return fmt.Errorf("cooldown cannot be negative")
+	}
+
+	for _, name := range r.Exchanges {
+		if findExchange(exchanges, name) == nil {
+			return fmt.Errorf("unknown exchange %s", name)
+		}
+	}
+	for _, symbol := range r.Symbols {
+		if !containsSymbol(set.Config.Symbols, symbol) {
+			return fmt.Errorf("unknown symbol %s", symbol)
+		}
+	}
+
+	for _, name := range r.Channels {
+		if _, ok := set.Notifiers[name]; !ok {
+			return fmt.Errorf("unknown notifier %s", name)
+		}
+	}
+
+	if r.ActiveHours != nil {
+		if _, err := r.ActiveHours.contains(time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isActive tells if the rule applies at t, a rule with invalid hours never
+// does.
+func (r AlertRule) isActive(t time.Time) bool {
+	if r.ActiveHours == nil {
+		return true
+	}
+	active, err := r.ActiveHours.contains(t)
+	return err == nil && active
+}
+
+func (h ActiveHours) contains(t time.Time) (bool, error) {
+	location, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		return false, fmt.Errorf("invalid timezone %s : %s", h.Timezone, err)
+	}
+	from, err := time.Parse("15:04", h.From)
+	if err != nil {
+		return false, fmt.Errorf("invalid start of the active hours : %s", err)
+	}
+	to, err := time.Parse("15:04", h.To)
+	if err != nil {
+		return false, fmt.Errorf("invalid end of the active hours : %s", err)
+	}
+
+	t = t.In(location)
+	minute := t.Hour()*60 + t.Minute()
+	start, end := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	if start <= end {
+		return minute >= start && minute < end, nil
+	}
+	return minute >= start || minute < end, nil
+}
+
+// RuleStore keeps the alert rules in a JSON file that is rewritten on every
+// change.
+type RuleStore struct {
+	path string
+
+	mu    sync.Mutex
+	rules map[string]AlertRule
+}
+
+func NewRuleStore(path string) (*RuleStore, error) {
+	s := &RuleStore{path: path, rules: map[string]AlertRule{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the rules file %s : %s", path, err)
+	}
+
+	var list []AlertRule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse the rules file %s : %s", path, err)
+	}
+	for _, r := range list {
+		s.rules[r.ID] = r
+	}
+	return s, nil
+}
+
+// List returns the rules of owner, or every rule when owner is empty, sorted
+// by owner and ID.
+func (s *RuleStore) List(owner string) []AlertRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []AlertRule
+	for _, r := range s.rules {
+		if owner == "" || r.Owner == owner {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Owner != list[j].Owner {
+			return list[i].Owner < list[j].Owner
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func (s *RuleStore) Get(id string) (AlertRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rules[id]
+	return r, ok
+}
+
+// Put adds or replaces the rule and writes the file. The change is undone
+// when the file cannot be written.
+func (s *RuleStore) Put(r AlertRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, existed := s.rules[r.ID]
+	s.rules[r.ID] = r
+	if err := s.save(); err != nil {
+		if existed {
+			s.rules[r.ID] = old
+		} else {
+			delete(s.rules, r.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *RuleStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.rules[id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.rules, id)
+	if err := s.save(); err != nil {
+		s.rules[id] = old
+		return true, err
+	}
+	return true, nil
+}
+
+// save writes to a temporary file first so a crash never leaves a truncated
+// rules file. It must be called with s.mu held.
+func (s *RuleStore) save() error {
+	list := []AlertRule{}
+	for _, r := range s.rules {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the rules : %s", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create the rules file : %s", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write the rules file : %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write the rules file : %s", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace the rules file : %s", err)
+	}
+	return nil
+}
+
+// globalRules turn the thresholds of the notification page into rules over
+// the notification exchanges that are not excluded. They keep applying next
+// to the stored ones while the fiat notifications are enabled.
+func globalRules(cfg *Config) []AlertRule {
+	n := cfg.Notification
+	if !n.FiatEnabled {
+		return nil
+	}
+
+	var exchanges []string
+	for _, exchange := range n.Exchanges {
+		if !containsSymbol(n.GlobalExcludes, exchange) {
+			exchanges = append(exchanges, exchange)
+		}
+	}
+	if len(exchanges) == 0 {
+		return nil
+	}
+
+	return []AlertRule{
+		{ID: "global-ask", Owner: GLOBAL_RULE_OWNER, Exchanges: exchanges, Side: RULE_ASK, Threshold: n.Minimum, Cooldown: n.Duration},
+		{ID: "global-bid", Owner: GLOBAL_RULE_OWNER, Exchanges: exchanges, Side: RULE_BID, Threshold: n.Maximum, Cooldown: n.Duration},
+	}
+}
+
+// activeRules returns the stored and the global rules.
+func (s *Server) activeRules(cfg *Config) []AlertRule {
+	list := globalRules(cfg)
+	if s.rules != nil {
+		list = append(list, s.rules.List("")...)
+	}
+	return list
+}
+
+func newRuleID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a rule id : %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkRules validates the stored rules against the applied config and logs
+// the ones referring to exchanges, symbols or notifiers it no longer has. Such
+// a rule keeps matching what is left of it.
+func (s *Server) checkRules() {
+	if s.rules == nil {
+		return
+	}
+
+	set := s.settings.Snapshot()
+	for _, r := range s.rules.List("") {
+		if err := r.validate(set, s.exchanges); err != nil {
+			fmt.Println("Rule ", r.ID, " of ", r.Owner, " does not match the config : ", err)
+			log.Println("Rule ", r.ID, " of ", r.Owner, " does not match the config : ", err)
+		}
+	}
+}
+
+// GetRules lists the stored rules, of one owner when the owner parameter is
+// given. Like the other rule endpoints it needs the admin token.
+func (s *Server) GetRules(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"time": s.clock.Now(), "rules": s.rules.List(c.Query("owner"))})
+}
+
+func (s *Server) GetRule(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	r, ok := s.rules.Get(c.Param("id"))
+	if !ok {
+		c.String(http.StatusNotFound, "unknown rule %s", c.Param("id"))
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// CreateRule stores a new rule under a generated ID. It needs the admin
+// token like the other admin endpoints.
+func (s *Server) CreateRule(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	var r AlertRule
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := newRuleID()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	r.ID = id
+	s.saveRule(c, r, http.StatusCreated)
+}
+
+// UpdateRule replaces the rule with the given ID.
+func (s *Server) UpdateRule(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	if _, ok := s.rules.Get(c.Param("id")); !ok {
+		c.String(http.StatusNotFound, "unknown rule %s", c.Param("id"))
+		return
+	}
+
+	var r AlertRule
+	if err := c.ShouldBindJSON(&r); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	r.ID = c.Param("id")
+	s.saveRule(c, r, http.StatusOK)
+}
+
+func (s *Server) saveRule(c *gin.Context, r AlertRule, status int) {
+	if err := r.validate(s.settings.Snapshot(), s.exchanges); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.rules.Put(r); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(status, r)
+}
+
+func (s *Server) DeleteRule(c *gin.Context) {
+	if !s.authorizeAdmin(c) {
+		return
+	}
+
+	found, err := s.rules.Delete(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		c.String(http.StatusNotFound, "unknown rule %s", c.Param("id"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
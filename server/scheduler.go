@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	DEFAULT_REQUESTS_PER_SECOND = 5.0
+	DEFAULT_BURST               = 5
+	DEFAULT_CONCURRENCY         = 4
+
+	// How often the scheduler starts the pollers of newly enabled exchanges.
+	POLLER_CHECK_INTERVAL = 1 * time.Second
+)
+
+// tokenBucket is the request budget of a source. It holds up to burst
+// tokens and gains rate tokens per second, every request takes one. No
+// request is made before blockedUntil, the end of the wait the source asked
+// for.
+type tokenBucket struct {
+	mu           sync.Mutex
+	rate         float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (b *tokenBucket) setLimits(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rate, b.burst = rate, float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// block keeps the requests off until t, an earlier deadline does not shorten
+// the current one.
+func (b *tokenBucket) block(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.After(b.blockedUntil) {
+		b.blockedUntil = t
+	}
+}
+
+// blocked returns the deadline when it is after now.
+func (b *tokenBucket) blocked(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.blockedUntil, now.Before(b.blockedUntil)
+}
+
+// budget returns the budget of the source, which follows the config of the
+// exchange.
+func (c *HTTPClient) budget(cfg *Config, source string) *tokenBucket {
+	rate, burst := exchangeBudget(cfg, source)
+
+	c.mu.Lock()
+	b, ok := c.budgets[source]
+	if !ok {
+		b = newTokenBucket(rate, burst)
+		c.budgets[source] = b
+	}
+	c.mu.Unlock()
+
+	if ok {
+		b.setLimits(rate, burst)
+	}
+	return b
+}
+
+// waitForBudget takes a token from the budget of the source. It fails right
+// away while the source is blocked.
+func (c *HTTPClient) waitForBudget(ctx context.Context, cfg *Config, source string) error {
+	b := c.budget(cfg, source)
+	if err := c.checkBlocked(b, source); err != nil {
+		return err
+	}
+	return b.Wait(ctx)
+}
+
+// checkBlocked fails and accounts a skipped request while the source is
+// blocked.
+func (c *HTTPClient) checkBlocked(b *tokenBucket, source string) error {
+	until, blocked := b.blocked(time.Now())
+	if !blocked {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.statsOf(source).Skipped++
+	c.mu.Unlock()
+	return fmt.Errorf("%s asked to wait until %s", source, until.Format(time.RFC3339))
+}
+
+// fetchSymbols runs fetch for every symbol with at most the concurrency of
+// the exchange in parallel. The prices keep the order of the symbols, the
+// first error cancels the others and is returned.
+func (v venue) fetchSymbols(ctx context.Context, source string, symbols []string, fetch func(ctx context.Context, symbol string) (Price, error)) ([]Price, error) {
+	// A blocked source is skipped until its deadline instead of failing
+	// every symbol.
+	if err := v.client.checkBlocked(v.client.budget(v.config(), source), source); err != nil {
+		return nil, err
+	}
+
+	prices := make([]Price, len(symbols))
+	slots := make(chan struct{}, exchangeConcurrency(v.config(), source))
+
+	g, ctx := errgroup.WithContext(ctx)
+	for i, symbol := range symbols {
+		i, symbol := i, symbol
+		g.Go(func() error {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-slots }()
+
+			p, err := fetch(ctx, symbol)
+			if err != nil {
+				return err
+			}
+			prices[i] = p
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// poller refreshes one source on its own schedule, so a slow source never
+// delays the others.
+type poller struct {
+	name     string
+	interval func() time.Duration
+	active   func() bool
+	fetch    func(ctx context.Context)
+}
+
+// run fetches until the source is disabled or ctx is done. A fetch that
+// takes longer than the interval is followed by the next one right away.
+func (p poller) run(ctx context.Context) {
+	for ctx.Err() == nil && p.active() {
+		start := time.Now()
+		p.fetch(ctx)
+
+		if !sleep(ctx, p.interval()-time.Since(start)) {
+			return
+		}
+	}
+}
+
+// getPrices starts a poller for the Binance references, the Bittrex volumes
+// and every active exchange, and the ones of the exchanges a reload enables.
+// Once ctx is done it waits for the pollers to return.
+func (s *Server) getPrices(ctx context.Context) {
+	var (
+		mu      sync.Mutex
+		pollers sync.WaitGroup
+	)
+	running := map[string]bool{}
+	defer pollers.Wait()
+
+	start := func(p poller) {
+		mu.Lock()
+		defer mu.Unlock()
+		if running[p.name] {
+			return
+		}
+
+		running[p.name] = true
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			p.run(ctx)
+			mu.Lock()
+			delete(running, p.name)
+			mu.Unlock()
+		}()
+	}
+
+	always := func() bool { return true }
+	for {
+		start(poller{name: BINANCE, interval: s.referenceInterval, active: always, fetch: s.fetchBinancePrices})
+		start(poller{name: BITTREX, interval: s.referenceInterval, active: always, fetch: s.fetchDOGEVolumes})
+
+		for _, e := range s.activeExchanges(s.currentConfig()) {
+			e := e
+			start(poller{
+				name:     e.Name(),
+				interval: func() time.Duration { return exchangeInterval(s.currentConfig(), e.Name()) },
+				active:   func() bool { return s.findActiveExchange(s.currentConfig(), e.Name()) != nil },
+				fetch:    func(ctx context.Context) { s.fetchExchangePrices(ctx, e) },
+			})
+		}
+
+		if !sleep(ctx, POLLER_CHECK_INTERVAL) {
+			return
+		}
+	}
+}
+
+// sleep waits for d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (s *Server) referenceInterval() time.Duration {
+	return s.currentConfig().Intervals.Prices
+}
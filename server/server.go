@@ -1,16 +1,22 @@
 package server
 
 import (
+	"context"
+	"embed"
 	"fmt"
+	"html/template"
 	"log"
 	"math"
+	"net"
 	"net/http"
-	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	ws "github.com/gorilla/websocket"
 )
 
 type Price struct {
@@ -19,655 +25,1083 @@ type Price struct {
 	ID       string
 	Ask      float64
 	Bid      float64
+	// ExchangeTime is the quote time reported by the exchange, zero when the
+	// API does not give one. ReceivedAt is when the quote was fetched.
+	ExchangeTime time.Time
+	ReceivedAt   time.Time
 }
 
 const (
-	BASE_CURRENCY_URI = "https://www.alphavantage.co/query?function=CURRENCY_EXCHANGE_RATE&from_currency=USD&to_currency=%s&apikey=GOJHTH53I4S9GPIV"
+	BASE_CURRENCY_URI = "https://www.alphavantage.co/query?function=CURRENCY_EXCHANGE_RATE&from_currency=USD&to_currency=%s&apikey=%s"
 )
 
+// Clock tells the time the quotes are stamped with and compared against.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
 var (
-	diffs                                                                              map[string]float64
-	prices, spreads                                                                    map[string]float64
-	minDiffs, maxDiffs                                                                 map[string]float64
-	dogeVolumes                                                                        map[string]float64
-	minSymbol, maxSymbol                                                               map[string]string
-	binancePrices                				 										 					 								 map[string]Price
-	coinbaseProPrices               				 																					 map[string]*Price
-	paribuPrices,btcTurkPrices, koineksPrices, koinimPrices, vebitcoinPrices, bitoasisPrices []Price
-	btcTurkETHBTCAskBid, btcTurkETHBTCBidAsk                                           float64
-	koineksETHBTCAskBid, koineksETHBTCBidAsk, koineksLTCBTCAskBid, koineksLTCBTCBidAsk float64
-	koinimLTCBTCAskBid, koinimLTCBTCBidAsk                                             float64
-	fiatNotificationEnabled                                                            = true
-	warning                                                                            string
-
-	mux sync.Mutex
-
-	ALL_SYMBOLS = []string{"BTC", "ETH", "LTC", "BCH", "ETC", "ZRX", "XRP", "XLM", "EOS", "USDT", "DOGE", "XEM", "LINK", "DASH"}
+	DEFAULT_ADDR = ":8080"
+	// SHUTDOWN_TIMEOUT bounds the shutdown that follows the end of the
+	// context given to Start.
+	SHUTDOWN_TIMEOUT = 10 * time.Second
 )
 
-func Run() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("$PORT must be set")
-	}
+// templateFiles are the built-in dashboard templates.
+//
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
 
-	router := gin.New()
-	router.Use(gin.Logger())
-	router.LoadHTMLGlob("templates/*")
+// Server is the arbitrage engine with its dashboard and API. It is built
+// with NewServer and options, the zero options give the production setup.
+// Every Server keeps its own settings, market data, history and rules, so
+// several of them can run in one process.
+type Server struct {
+	addr        string
+	configFile  string
+	config      *Config
+	templateDir string
+	clock       Clock
+	httpClient  *HTTPClient
+	notifiers   map[string]Notifier
+	exchanges   []Exchange
+	binance     Exchange
+	fxProviders []FxProvider
+	store       *MarketStore
+	// flushHooks run on Shutdown once the loops stopped.
+	flushHooks []func(ctx context.Context) error
 
-	router.GET("/", PrintTableWithBinance)
-	router.GET("/notification", SetNotificationLimits)
+	settings  *settingsStore
+	reloadMux sync.Mutex
+	history   *HistoryStore
+	rules     *RuleStore
+	stream    *streamBroadcaster
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		router.Run(":" + port)
-	}()
+	// mux guards the rates, the depths, the leaders and the Coinbase Pro
+	// feed state below.
+	mux              sync.Mutex
+	usdRates         map[string]float64
+	impliedRates     map[string]float64
+	rateTimes        map[string]time.Time
+	fxSources        map[string][]FxSourceRate
+	depths           map[string]DepthAnalysis
+	leaders          map[string]Leader
+	leaderChanges    []LeaderChange
+	coinbaseProConn  *ws.Conn
+	coinbaseProState FeedState
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getCurrencies()
-	}()
+	// The refresh times are only used by the currency loop, the
+	// notification times by the diff loop.
+	fxNextRefresh     map[string]time.Time
+	fxAlerts          map[string]time.Time
+	notificationFlags map[string]bool
+	notificationTimes map[string]time.Time
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		startCoinbaseProWS()
-	}()
+	// deliveries tracks the notifications still being sent, they are given
+	// up when deliveryCtx is cancelled.
+	deliveries       sync.WaitGroup
+	deliveryCtx      context.Context
+	cancelDeliveries context.CancelFunc
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		getPrices()
-	}()
+	router      *gin.Engine
+	templateErr error
+	httpServer  *http.Server
+	listener    net.Listener
+	stop        context.CancelFunc
+	loops       sync.WaitGroup
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		calculateDiffs()
-	}()
+	// startMux makes Start and Shutdown exclusive, started is set between
+	// them. stopped is closed by the shutdown of the run.
+	startMux sync.Mutex
+	started  bool
+	stopped  chan struct{}
+}
 
-	wg.Wait()
+// Option changes a setting of a Server before it starts.
+type Option func(*Server)
+
+// WithAddr sets the address the dashboard and API listen on. With an empty
+// address Start does not listen, the embedding service serves Handler.
+func WithAddr(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
 }
 
-func getPrices() {
-	for {
-		calculatePrices()
-		time.Sleep(2 * time.Second)
+// WithConfigFile sets the file read at startup and on every reload.
+func WithConfigFile(path string) Option {
+	return func(s *Server) {
+		s.configFile = path
 	}
 }
 
-func calculateDiffs() {
-	for {
-		findAltcoinPrices(binancePrices, paribuPrices, btcTurkPrices, koineksPrices, koinimPrices, vebitcoinPrices, bitoasisPrices)
-		sendMessages()
-		resetDiffsAndSymbols()
-		time.Sleep(1 * time.Second)
+// WithConfig starts the server with cfg instead of reading the config file.
+// The reloads apply cfg again, they never read the file.
+func WithConfig(cfg *Config) Option {
+	return func(s *Server) {
+		s.config = cfg
 	}
 }
 
-func calculatePrices() {
-	var err error
+// WithTemplateDir reads the dashboard templates from dir instead of the
+// built-in ones.
+func WithTemplateDir(dir string) Option {
+	return func(s *Server) {
+		s.templateDir = dir
+	}
+}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		binancePrices, err = getBinancePrices()
-		if err != nil || len(binancePrices) != len(binanceCurrencies) {
-			message := fmt.Sprintf("Error reading Binance prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
-		}
-	}()
+// WithClock replaces the system clock the quotes are stamped with.
+func WithClock(clock Clock) Option {
+	return func(s *Server) {
+		s.clock = clock
+	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		paribuPrices, err = getParibuPrices()
-		if err != nil {
-			message := fmt.Sprintf("Error reading Paribu prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
-		}
-	}()
+// WithHTTPClient makes the exchange and rate requests and the notifications
+// through client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.httpClient = NewHTTPClient(client)
+	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		btcTurkPrices, err = getBTCTurkPrices()
+// WithNotifier adds a notifier next to the configured ones, the channels can
+// refer to it by name.
+func WithNotifier(name string, n Notifier) Option {
+	return func(s *Server) {
+		s.notifiers[name] = n
+	}
+}
+
+// WithExchanges replaces the registered exchanges.
+func WithExchanges(list ...Exchange) Option {
+	return func(s *Server) {
+		s.exchanges = append([]Exchange{}, list...)
+	}
+}
+
+// WithFlushHook runs hook on Shutdown after the history is closed, to
+// persist the state of the embedding service.
+func WithFlushHook(hook func(ctx context.Context) error) Option {
+	return func(s *Server) {
+		s.flushHooks = append(s.flushHooks, hook)
+	}
+}
+
+// WithStore publishes the market data to store.
+func WithStore(store *MarketStore) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// NewServer builds a Server with the registered exchanges, the system clock
+// and a new store, changed by the options.
+func NewServer(options ...Option) *Server {
+	s := &Server{
+		addr:       DEFAULT_ADDR,
+		configFile: DEFAULT_CONFIG_FILE,
+		clock:      systemClock{},
+		httpClient: NewHTTPClient(&http.Client{}),
+		notifiers:  map[string]Notifier{},
+		store:      NewMarketStore(),
+		stream:     newStreamBroadcaster(),
+
+		usdRates:         map[string]float64{},
+		impliedRates:     map[string]float64{},
+		rateTimes:        map[string]time.Time{},
+		fxSources:        map[string][]FxSourceRate{},
+		depths:           map[string]DepthAnalysis{},
+		leaders:          map[string]Leader{},
+		coinbaseProState: FeedState{Status: FEED_CONNECTING},
+
+		fxNextRefresh:     map[string]time.Time{},
+		fxAlerts:          map[string]time.Time{},
+		notificationFlags: map[string]bool{},
+		notificationTimes: map[string]time.Time{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.settings = newSettingsStore(s.newSettings(defaultConfig()))
+	s.httpClient.settings = s.settings
+	v := venue{client: s.httpClient, settings: s.settings}
+	if s.exchanges == nil {
+		s.exchanges = newExchanges(v)
+	}
+	s.binance = binanceExchange{venue: v, market: s.store}
+	s.fxProviders = []FxProvider{alphaVantageProvider{v}, centralBankProvider{v}, impliedProvider{s}}
+	s.initReferencePrices(defaultConfig())
+
+	s.router = gin.New()
+	s.router.Use(gin.Logger())
+	// NewServer cannot fail, Start reports a template that does not parse.
+	templates, err := s.parseTemplates()
+	if err != nil {
+		s.templateErr = err
+	} else {
+		s.router.SetHTMLTemplate(templates)
+	}
+
+	s.router.GET("/", s.PrintTableWithBinance)
+	s.router.GET("/notification", s.SetNotificationLimits)
+	s.router.GET("/history", s.GetHistory)
+	s.router.GET("/matrix", s.PrintSpreadMatrix)
+	s.router.GET("/stream", s.StreamDashboard)
+	s.router.POST("/admin/reload", s.ReloadConfigHandler)
+	s.addAPIRoutes(s.router)
+
+	return s
+}
+
+// parseTemplates parses the built-in templates, or the ones of the template
+// directory when it is set.
+func (s *Server) parseTemplates() (*template.Template, error) {
+	if s.templateDir == "" {
+		t, err := template.ParseFS(templateFiles, "templates/*.tmpl")
 		if err != nil {
-			message := fmt.Sprintf("Error reading BTCTurk prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+			return nil, fmt.Errorf("failed to parse the built-in templates : %s", err)
 		}
-	}()
+		return t, nil
+	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		koineksPrices, err = getKoineksPrices()
-		if err != nil {
-			message := fmt.Sprintf("Error reading Koineks prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+	t, err := template.ParseGlob(filepath.Join(s.templateDir, "*.tmpl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the templates in %s : %s", s.templateDir, err)
+	}
+	return t, nil
+}
+
+// Handler returns the dashboard and API routes.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Addr returns the address the server listens on, it is only known once it
+// started.
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Start applies the config, opens the history and the rules, starts
+// listening and starts the loops. The server runs until Shutdown is called or
+// ctx is done, which shuts it down within SHUTDOWN_TIMEOUT. It fails when the
+// server is already running.
+func (s *Server) Start(ctx context.Context) error {
+	s.startMux.Lock()
+	defer s.startMux.Unlock()
+
+	if s.started {
+		return fmt.Errorf("failed to start the server : it is already running")
+	}
+	if s.templateErr != nil {
+		return s.templateErr
+	}
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+	s.applyConfig(cfg)
+
+	if s.history, err = NewHistoryStore(cfg.HistoryDir, s.clock); err != nil {
+		return err
+	}
+	if s.rules, err = NewRuleStore(cfg.RulesFile); err != nil {
+		s.history.Close()
+		return err
+	}
+	s.checkRules()
+
+	if s.addr != "" {
+		if s.listener, err = net.Listen("tcp", s.addr); err != nil {
+			s.history.Close()
+			return fmt.Errorf("failed to listen on %s : %s", s.addr, err)
 		}
-	}()
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		koinimPrices, err = getKoinimPrices()
-		if err != nil {
-			message := fmt.Sprintf("Error reading Koinim prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+		s.httpServer = &http.Server{Handler: s.router}
+		// The dashboard streams never go idle, they are ended so the
+		// shutdown does not wait for them.
+		s.httpServer.RegisterOnShutdown(s.stream.close)
+		go func(httpServer *http.Server, listener net.Listener) {
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				fmt.Println("Failed to serve : ", err)
+				log.Println("Failed to serve : ", err)
+			}
+		}(s.httpServer, s.listener)
+	}
+
+	s.deliveryCtx, s.cancelDeliveries = context.WithCancel(context.Background())
+	ctx, s.stop = context.WithCancel(ctx)
+	for _, loop := range []func(ctx context.Context){s.watchConfigReloads, s.getCurrencies, s.startCoinbaseProWS, s.getPrices, s.calculateDiffs, s.getDepths} {
+		s.loops.Add(1)
+		go func(loop func(ctx context.Context)) {
+			defer s.loops.Done()
+			loop(ctx)
+		}(loop)
+	}
+
+	s.started = true
+	s.stopped = make(chan struct{})
+	go s.shutdownWith(ctx, s.stopped)
+	return nil
+}
+
+// shutdownWith shuts the run down when ctx is done, unless Shutdown stopped
+// it first.
+func (s *Server) shutdownWith(ctx context.Context, stopped chan struct{}) {
+	select {
+	case <-stopped:
+		return
+	case <-ctx.Done():
+	}
+
+	// Shutdown cancels ctx too, it may hold startMux until the run is over.
+	s.startMux.Lock()
+	defer s.startMux.Unlock()
+	select {
+	case <-stopped:
+		return
+	default:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := s.shutdown(shutdownCtx); err != nil {
+		fmt.Println("Failed to shut down : ", err)
+		log.Println("Failed to shut down : ", err)
+	}
+}
+
+// Shutdown stops accepting requests, stops the loops, then closes the
+// history, waits for the notifications being sent and runs the flush hooks.
+// It gives up waiting when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.startMux.Lock()
+	defer s.startMux.Unlock()
+
+	if !s.started {
+		return nil
+	}
+	return s.shutdown(ctx)
+}
+
+// shutdown must be called with startMux held while the server runs.
+func (s *Server) shutdown(ctx context.Context) error {
+	close(s.stopped)
+
+	var errs []string
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to stop the HTTP server : %s", err))
 		}
-	}()
+	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		vebitcoinPrices, err = getVebitcoinPrices()
-		if err != nil {
-			message := fmt.Sprintf("Error reading Vebitcoin prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+	s.stop()
+	if err := wait(ctx, &s.loops); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to stop the loops : %s", err))
+	}
+
+	// The loops that outlived ctx can no longer write to the history.
+	if err := s.history.Close(); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to close the price history : %s", err))
+	}
+	if err := wait(ctx, &s.deliveries); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to send the notifications : %s", err))
+	}
+	// The deliveries still retrying are given up.
+	s.cancelDeliveries()
+	for _, hook := range s.flushHooks {
+		if err := hook(ctx); err != nil {
+			errs = append(errs, err.Error())
 		}
-	}()
+	}
+
+	s.started = false
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
 
-	wg.Add(1)
+// wait waits for wg until ctx is done.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
 	go func() {
-		defer wg.Done()
-		bitoasisPrices, err = getBitoasisPrices()
-		if err != nil {
-			message := fmt.Sprintf("Error reading Bitoasis prices : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
-		}
+		wg.Wait()
+		close(done)
 	}()
 
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := getBittrexDOGEVolumes(); err != nil {
-			message := fmt.Sprintf("Error reading Bittrex DOGE volumes : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+// calculateDiffs takes the settings once per cycle, a reload applies from the
+// next one.
+func (s *Server) calculateDiffs(ctx context.Context) {
+	for {
+		set := s.settings.Snapshot()
+		state := s.findAltcoinPrices(set.Config)
+		s.updateLeaders(state, set.Config, s.clock.Now())
+		if err := s.history.Flush(); err != nil {
+			fmt.Println("Failed to flush the price history : ", err)
+			log.Println("Failed to flush the price history : ", err)
 		}
+		s.publishDashboard(set.Config)
+		s.sendMessages(set)
+		s.resetDiffsAndSymbols()
 
-		if err := getBinanceDOGEVolumes(); err != nil {
-			message := fmt.Sprintf("Error reading Binance DOGE volumes : %s", err)
-			warning += message + "\n"
-			fmt.Println(message)
-			log.Println(message)
+		if !sleep(ctx, set.Config.Intervals.Diffs) {
+			return
 		}
-	}()
-	wg.Wait()
+	}
 }
 
-func findAltcoinPrices(exchangePrices map[string]Price, sellExchanges ...[]Price) {
-	bitcoinPrice := coinbaseProPrices["BTC"].Ask
-	for _, p := range exchangePrices {
+func (s *Server) fetchBinancePrices(ctx context.Context) {
+	list, err := s.binance.FetchTickers(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil || len(list) != len(s.binance.Symbols()) {
+		s.addWarning(fmt.Sprintf("Error reading %s prices : %s", s.binance.Name(), err))
+	}
+
+	s.store.Update(func(next *MarketState) {
+		s.setQuoteTimes(next, list)
+		for _, p := range list {
+			next.BinancePrices[p.ID] = p
+		}
+	})
+}
+
+// fetchExchangePrices keeps the previous prices of the exchange when the
+// fetch fails, they turn stale in time.
+func (s *Server) fetchExchangePrices(ctx context.Context, e Exchange) {
+	list, err := e.FetchTickers(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		s.addWarning(fmt.Sprintf("Error reading %s prices : %s", e.Name(), err))
+	} else {
+		s.store.Update(func(next *MarketState) {
+			s.setQuoteTimes(next, list)
+			next.ExchangePrices[e.Name()] = list
+		})
+	}
+
+	cross, ok := e.(CrossExchange)
+	if !ok {
+		return
+	}
+
+	list, err = cross.FetchCrossTickers(ctx)
+	if err != nil {
+		s.addWarning(fmt.Sprintf("Error reading %s BTC pair prices : %s", e.Name(), err))
+		return
+	}
+
+	// The quote times are keyed without the currency, so the BTC pairs are
+	// only stamped on the prices.
+	now := s.clock.Now()
+	for i := range list {
+		list[i].ReceivedAt = now
+	}
+
+	s.store.Update(func(next *MarketState) {
+		next.BTCPairPrices[e.Name()] = list
+	})
+}
+
+func (s *Server) fetchDOGEVolumes(ctx context.Context) {
+	if err := s.getBittrexDOGEVolumes(ctx); err != nil {
+		s.addWarning(fmt.Sprintf("Error reading Bittrex DOGE volumes : %s", err))
+	}
+
+	if err := s.getBinanceDOGEVolumes(ctx); err != nil {
+		s.addWarning(fmt.Sprintf("Error reading Binance DOGE volumes : %s", err))
+	}
+}
+
+// setQuoteTimes stamps the given quotes as received now in the state being
+// updated.
+func (s *Server) setQuoteTimes(next *MarketState, list []Price) {
+	now := s.clock.Now()
+	for i, p := range list {
+		list[i].ReceivedAt = now
+		next.QuoteTimes[p.Exchange+"-"+p.ID] = now
+	}
+}
+
+// quoteAge is the time since the quote was received, or since the exchange
+// made it when that is earlier.
+func quoteAge(p Price, now time.Time) time.Duration {
+	quoteTime := p.ReceivedAt
+	if !p.ExchangeTime.IsZero() && p.ExchangeTime.Before(quoteTime) {
+		quoteTime = p.ExchangeTime
+	}
+	return now.Sub(quoteTime)
+}
+
+// isStale tells if the quote is older than the max age of its exchange in
+// cfg.
+// Coinbase Pro quotes are stale as soon as the feed is down. It must be
+// called with mux held.
+func (s *Server) isStale(cfg *Config, p Price, now time.Time) bool {
+	if p.ReceivedAt.IsZero() {
+		return true
+	}
+	if p.Exchange == GDAX && s.coinbaseProState.Status != FEED_CONNECTED {
+		return true
+	}
+	return quoteAge(p, now) > maxQuoteAge(cfg, p.Exchange)
+}
+
+func (s *Server) addWarning(message string) {
+	s.store.Update(func(next *MarketState) {
+		next.Warning += message + "\n"
+	})
+	fmt.Println(message)
+	log.Println(message)
+}
+
+// findAltcoinPrices converts the Binance references to USD, marks the stale
+// quotes and publishes them with the triangles, then the diffs. It returns
+// the state holding the new diffs.
+func (s *Server) findAltcoinPrices(cfg *Config) *MarketState {
+	now := s.clock.Now()
+	m := s.store.Snapshot()
+
+	bitcoin := m.CoinbaseProPrices["BTC"]
+	references := map[string]Price{}
+	for _, p := range m.BinancePrices {
 		multiplier := 1.0
+		receivedAt := p.ReceivedAt
 		if p.ID != "USDT" {
-			multiplier = bitcoinPrice
+			multiplier = bitcoin.Ask
+			// A cross price is only as fresh as the BTC price it is based on.
+			if bitcoin.ReceivedAt.Before(receivedAt) {
+				receivedAt = bitcoin.ReceivedAt
+			}
 		}
 
-		tempP, ok := coinbaseProPrices[p.ID]
+		reference, ok := m.CoinbaseProPrices[p.ID]
 		if !ok {
-			coinbaseProPrices[p.ID] = &Price{Exchange: p.Exchange, Currency: p.Currency, ID: p.ID, Ask: p.Ask*multiplier, Bid: p.Bid*multiplier}
-		} else {
-			tempP.Ask = p.Ask*multiplier
-			tempP.Bid = p.Bid*multiplier
-		}
-	}
-
-	var newPriceList [][]Price
-	for _, list := range sellExchanges {
-		newPriceList = append(newPriceList, list)
-	}
-	findPriceDifferences(newPriceList...)
-}
-
-func PrintTableWithBinance(c *gin.Context) {
-	printTable(c, binancePrices, BINANCE)
-}
-
-func printTable(c *gin.Context, crossPrices map[string]Price, exchange string) {
-	mux.Lock()
-	c.HTML(http.StatusOK, "index.tmpl", gin.H{
-		"USDTRY":                tryRate,
-		"USDAED":                aedRate,
-		"GdaxBTC":               coinbaseProPrices["BTC"].Ask,
-		"ParibuBTCAsk":          diffs[GDAX+"-Paribu-BTC-Ask"],
-		"ParibuBTCBid":          diffs[GDAX+"-Paribu-BTC-Bid"],
-		"BTCTurkBTCAsk":         diffs[GDAX+"-BTCTurk-BTC-Ask"],
-		"BTCTurkBTCBid":         diffs[GDAX+"-BTCTurk-BTC-Bid"],
-		"KoineksBTCAsk":         diffs[GDAX+"-Koineks-BTC-Ask"],
-		"KoineksBTCBid":         diffs[GDAX+"-Koineks-BTC-Bid"],
-		"KoinimBTCAsk":          diffs[GDAX+"-Koinim-BTC-Ask"],
-		"KoinimBTCBid":          diffs[GDAX+"-Koinim-BTC-Bid"],
-		"VebitcoinBTCAsk":       diffs[GDAX+"-Vebitcoin-BTC-Ask"],
-		"VebitcoinBTCBid":       diffs[GDAX+"-Vebitcoin-BTC-Bid"],
-		"BitoasisBTCAsk":        diffs[GDAX+"-Bitoasis-BTC-Ask"],
-		"BitoasisBTCBid":        diffs[GDAX+"-Bitoasis-BTC-Bid"],
-		"BitfinexBTCAsk":        diffs[GDAX+"-Bitfinex-BTC-Ask"],
-		"BitfinexBTCBid":        diffs[GDAX+"-Bitfinex-BTC-Bid"],
-		"CexioBTCAsk":           diffs[GDAX+"-Cexio-BTC-Ask"],
-		"CexioBTCBid":           diffs[GDAX+"-Cexio-BTC-Bid"],
-		"GdaxETH":               coinbaseProPrices["ETH"].Ask,
-		"ParibuETHAsk":          diffs[GDAX+"-Paribu-ETH-Ask"],
-		"ParibuETHBid":          diffs[GDAX+"-Paribu-ETH-Bid"],
-		"BTCTurkETHAsk":         diffs[GDAX+"-BTCTurk-ETH-Ask"],
-		"BTCTurkETHBid":         diffs[GDAX+"-BTCTurk-ETH-Bid"],
-		"KoineksETHAsk":         diffs[GDAX+"-Koineks-ETH-Ask"],
-		"KoineksETHBid":         diffs[GDAX+"-Koineks-ETH-Bid"],
-		"KoinimETHAsk":          diffs[GDAX+"-Koinim-ETH-Ask"],
-		"KoinimETHBid":          diffs[GDAX+"-Koinim-ETH-Bid"],
-		"VebitcoinETHAsk":       diffs[GDAX+"-Vebitcoin-ETH-Ask"],
-		"VebitcoinETHBid":       diffs[GDAX+"-Vebitcoin-ETH-Bid"],
-		"BitoasisETHAsk":        diffs[GDAX+"-Bitoasis-ETH-Ask"],
-		"BitoasisETHBid":        diffs[GDAX+"-Bitoasis-ETH-Bid"],
-		"BitfinexETHAsk":        diffs[GDAX+"-Bitfinex-ETH-Ask"],
-		"BitfinexETHBid":        diffs[GDAX+"-Bitfinex-ETH-Bid"],
-		"CexioETHAsk":           diffs[GDAX+"-Cexio-ETH-Ask"],
-		"CexioETHBid":           diffs[GDAX+"-Cexio-ETH-Bid"],
-		"GdaxLTC":               coinbaseProPrices["LTC"].Ask,
-		"ParibuLTCAsk":          diffs[GDAX+"-Paribu-LTC-Ask"],
-		"ParibuLTCBid":          diffs[GDAX+"-Paribu-LTC-Bid"],
-		"BTCTurkLTCAsk":         diffs[GDAX+"-BTCTurk-LTC-Ask"],
-		"BTCTurkLTCBid":         diffs[GDAX+"-BTCTurk-LTC-Bid"],
-		"KoineksLTCAsk":         diffs[GDAX+"-Koineks-LTC-Ask"],
-		"KoineksLTCBid":         diffs[GDAX+"-Koineks-LTC-Bid"],
-		"KoinimLTCAsk":          diffs[GDAX+"-Koinim-LTC-Ask"],
-		"KoinimLTCBid":          diffs[GDAX+"-Koinim-LTC-Bid"],
-		"VebitcoinLTCAsk":       diffs[GDAX+"-Vebitcoin-LTC-Ask"],
-		"VebitcoinLTCBid":       diffs[GDAX+"-Vebitcoin-LTC-Bid"],
-		"BitoasisLTCAsk":        diffs[GDAX+"-Bitoasis-LTC-Ask"],
-		"BitoasisLTCBid":        diffs[GDAX+"-Bitoasis-LTC-Bid"],
-		"BitfinexLTCAsk":        diffs[GDAX+"-Bitfinex-LTC-Ask"],
-		"BitfinexLTCBid":        diffs[GDAX+"-Bitfinex-LTC-Bid"],
-		"CexioLTCAsk":           diffs[GDAX+"-Cexio-LTC-Ask"],
-		"CexioLTCBid":           diffs[GDAX+"-Cexio-LTC-Bid"],
-		"GdaxBCH":               coinbaseProPrices["BCH"].Ask,
-		"BCHSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"BCH"]),
-		"ParibuBCHAsk":          diffs[GDAX+"-Paribu-BCH-Ask"],
-		"ParibuBCHBid":          diffs[GDAX+"-Paribu-BCH-Bid"],
-		"KoineksBCHAsk":         diffs[GDAX+"-Koineks-BCH-Ask"],
-		"KoineksBCHBid":         diffs[GDAX+"-Koineks-BCH-Bid"],
-		"KoinimBCHAsk":          diffs[GDAX+"-Koinim-BCH-Ask"],
-		"KoinimBCHBid":          diffs[GDAX+"-Koinim-BCH-Bid"],
-		"VebitcoinBCHAsk":       diffs[GDAX+"-Vebitcoin-BCH-Ask"],
-		"VebitcoinBCHBid":       diffs[GDAX+"-Vebitcoin-BCH-Bid"],
-		"BitoasisBCHAsk":        diffs[GDAX+"-Bitoasis-BCH-Ask"],
-		"BitoasisBCHBid":        diffs[GDAX+"-Bitoasis-BCH-Bid"],
-		"CexioBCHAsk":           diffs[GDAX+"-Cexio-BCH-Ask"],
-		"CexioBCHBid":           diffs[GDAX+"-Cexio-BCH-Bid"],
-		"GdaxETC":               coinbaseProPrices["ETC"].Ask,
-		"ETCSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"ETC"]),
-		"KoineksETCAsk":         diffs[GDAX+"-Koineks-ETC-Ask"],
-		"KoineksETCBid":         diffs[GDAX+"-Koineks-ETC-Bid"],
-		"GdaxZRX":               coinbaseProPrices["ZRX"].Ask,
-		"ZRXSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"ZRX"]),
-		"VebitcoinZRXAsk":       diffs[GDAX+"-Vebitcoin-ZRX-Ask"],
-		"VebitcoinZRXBid":       diffs[GDAX+"-Vebitcoin-ZRX-Bid"],
-		"GdaxXRP":               coinbaseProPrices["XRP"].Ask,
-		"XRPSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"XRP"]),
-		"ParibuXRPAsk":          diffs[GDAX+"-Paribu-XRP-Ask"],
-		"ParibuXRPBid":          diffs[GDAX+"-Paribu-XRP-Bid"],
-		"BTCTurkXRPAsk":         diffs[GDAX+"-BTCTurk-XRP-Ask"],
-		"BTCTurkXRPBid":         diffs[GDAX+"-BTCTurk-XRP-Bid"],
-		"KoineksXRPAsk":         diffs[GDAX+"-Koineks-XRP-Ask"],
-		"KoineksXRPBid":         diffs[GDAX+"-Koineks-XRP-Bid"],
-		"VebitcoinXRPAsk":       diffs[GDAX+"-Vebitcoin-XRP-Ask"],
-		"VebitcoinXRPBid":       diffs[GDAX+"-Vebitcoin-XRP-Bid"],
-		"BitoasisXRPAsk":        diffs[GDAX+"-Bitoasis-XRP-Ask"],
-		"BitoasisXRPBid":        diffs[GDAX+"-Bitoasis-XRP-Bid"],
-		"BitfinexXRPAsk":        diffs[GDAX+"-Bitfinex-XRP-Ask"],
-		"BitfinexXRPBid":        diffs[GDAX+"-Bitfinex-XRP-Bid"],
-		"CexioXRPAsk":           diffs[GDAX+"-Cexio-XRP-Ask"],
-		"CexioXRPBid":           diffs[GDAX+"-Cexio-XRP-Bid"],
-		"GdaxXLM":               coinbaseProPrices["XLM"].Ask,
-		"XLMSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"XLM"]),
-		"ParibuXLMAsk":          diffs[GDAX+"-Paribu-XLM-Ask"],
-		"ParibuXLMBid":          diffs[GDAX+"-Paribu-XLM-Bid"],
-		"BTCTurkXLMAsk":         diffs[GDAX+"-BTCTurk-XLM-Ask"],
-		"BTCTurkXLMBid":         diffs[GDAX+"-BTCTurk-XLM-Bid"],
-		"KoineksXLMAsk":         diffs[GDAX+"-Koineks-XLM-Ask"],
-		"KoineksXLMBid":         diffs[GDAX+"-Koineks-XLM-Bid"],
-		"VebitcoinXLMAsk":       diffs[GDAX+"-Vebitcoin-XLM-Ask"],
-		"VebitcoinXLMBid":       diffs[GDAX+"-Vebitcoin-XLM-Bid"],
-		"BitoasisXLMAsk":        diffs[GDAX+"-Bitoasis-XLM-Ask"],
-		"BitoasisXLMBid":        diffs[GDAX+"-Bitoasis-XLM-Bid"],
-		"BitfinexXLMAsk":        diffs[GDAX+"-Bitfinex-XLM-Ask"],
-		"BitfinexXLMBid":		 		 diffs[GDAX+"-Bitfinex-XLM-Bid"],
-		"CexioXLMAsk":           diffs[GDAX+"-Cexio-XLM-Ask"],
-		"CexioXLMBid":           diffs[GDAX+"-Cexio-XLM-Bid"],
-		"GdaxEOS":               coinbaseProPrices["EOS"].Ask,
-		"EOSSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"EOS"]),
-		"ParibuEOSAsk":          diffs[GDAX+"-Paribu-EOS-Ask"],
-		"ParibuEOSBid":          diffs[GDAX+"-Paribu-EOS-Bid"],
-		"KoineksEOSAsk":         diffs[GDAX+"-Koineks-EOS-Ask"],
-		"KoineksEOSBid":         diffs[GDAX+"-Koineks-EOS-Bid"],
-		"GdaxLINK":               coinbaseProPrices["LINK"].Ask,
-		"LINKSpread":             fmt.Sprintf("%.2f", spreads[GDAX+"LINK"]),
-		"ParibuLINKAsk":          diffs[GDAX+"-Paribu-LINK-Ask"],
-		"ParibuLINKBid":          diffs[GDAX+"-Paribu-LINK-Bid"],
-		"VebitcoinLINKAsk":       diffs[GDAX+"-Vebitcoin-LINK-Ask"],
-		"VebitcoinLINKBid":       diffs[GDAX+"-Vebitcoin-LINK-Bid"],
-		"BTCTurkLINKAsk":         diffs[GDAX+"-BTCTurk-LINK-Ask"],
-		"BTCTurkLINKBid":         diffs[GDAX+"-BTCTurk-LINK-Bid"],
-		"GdaxDASH":              coinbaseProPrices["DASH"].Ask,
-		"DASHSpread":            fmt.Sprintf("%.2f", spreads[GDAX+"DASH"]),
-		"KoineksDASHAsk":        diffs[GDAX+"-Koineks-DASH-Ask"],
-		"KoineksDASHBid":        diffs[GDAX+"-Koineks-DASH-Bid"],
-		"KoinimDASHAsk":      	 diffs[GDAX+"-Koinim-DASH-Ask"],
-		"KoinimDASHBid":      	 diffs[GDAX+"-Koinim-DASH-Bid"],
-		"VebitcoinDASHAsk":      diffs[GDAX+"-Vebitcoin-DASH-Ask"],
-		"VebitcoinDASHBid":      diffs[GDAX+"-Vebitcoin-DASH-Bid"],
-		"ParibuBTCAskPrice":     prices["Paribu-BTC-Ask"],
-		"ParibuBTCBidPrice":     prices["Paribu-BTC-Bid"],
-		"BTCTurkBTCAskPrice":    prices["BTCTurk-BTC-Ask"],
-		"BTCTurkBTCBidPrice":    prices["BTCTurk-BTC-Bid"],
-		"KoineksBTCAskPrice":    prices["Koineks-BTC-Ask"],
-		"KoineksBTCBidPrice":    prices["Koineks-BTC-Bid"],
-		"KoinimBTCAskPrice":     prices["Koinim-BTC-Ask"],
-		"KoinimBTCBidPrice":     prices["Koinim-BTC-Bid"],
-		"VebitcoinBTCAskPrice":  prices["Vebitcoin-BTC-Ask"],
-		"VebitcoinBTCBidPrice":  prices["Vebitcoin-BTC-Bid"],
-		"BitoasisBTCAskPrice":   prices["Bitoasis-BTC-Ask"],
-		"BitoasisBTCBidPrice":   prices["Bitoasis-BTC-Bid"],
-		"BitfinexBTCAskPrice":   prices["Bitfinex-BTC-Ask"],
-		"BitfinexBTCBidPrice":   prices["Bitfinex-BTC-Bid"],
-		"CexioBTCAskPrice":      prices["Cexio-BTC-Ask"],
-		"CexioBTCBidPrice":      prices["Cexio-BTC-Bid"],
-		"ParibuETHAskPrice":     prices["Paribu-ETH-Ask"],
-		"ParibuETHBidPrice":     prices["Paribu-ETH-Bid"],
-		"BTCTurkETHAskPrice":    prices["BTCTurk-ETH-Ask"],
-		"BTCTurkETHBidPrice":    prices["BTCTurk-ETH-Bid"],
-		"KoineksETHAskPrice":    prices["Koineks-ETH-Ask"],
-		"KoineksETHBidPrice":    prices["Koineks-ETH-Bid"],
-		"KoinimETHAskPrice":     prices["Koinim-ETH-Ask"],
-		"KoinimETHBidPrice":     prices["Koinim-ETH-Bid"],
-		"VebitcoinETHAskPrice":  prices["Vebitcoin-ETH-Ask"],
-		"VebitcoinETHBidPrice":  prices["Vebitcoin-ETH-Bid"],
-		"BitoasisETHAskPrice":   prices["Bitoasis-ETH-Ask"],
-		"BitoasisETHBidPrice":   prices["Bitoasis-ETH-Bid"],
-		"BitfinexETHAskPrice":   prices["Bitfinex-ETH-Ask"],
-		"BitfinexETHBidPrice":   prices["Bitfinex-ETH-Bid"],
-		"CexioETHAskPrice":      prices["Cexio-ETH-Ask"],
-		"CexioETHBidPrice":      prices["Cexio-ETH-Bid"],
-		"ParibuLTCAskPrice":     prices["Paribu-LTC-Ask"],
-		"ParibuLTCBidPrice":     prices["Paribu-LTC-Bid"],
-		"BTCTurkLTCAskPrice":    prices["BTCTurk-LTC-Ask"],
-		"BTCTurkLTCBidPrice":    prices["BTCTurk-LTC-Bid"],
-		"KoineksLTCAskPrice":    prices["Koineks-LTC-Ask"],
-		"KoineksLTCBidPrice":    prices["Koineks-LTC-Bid"],
-		"KoinimLTCAskPrice":     prices["Koinim-LTC-Ask"],
-		"KoinimLTCBidPrice":     prices["Koinim-LTC-Bid"],
-		"VebitcoinLTCAskPrice":  prices["Vebitcoin-LTC-Ask"],
-		"VebitcoinLTCBidPrice":  prices["Vebitcoin-LTC-Bid"],
-		"BitoasisLTCAskPrice":   prices["Bitoasis-LTC-Ask"],
-		"BitoasisLTCBidPrice":   prices["Bitoasis-LTC-Bid"],
-		"BitfinexLTCAskPrice":   prices["Bitfinex-LTC-Ask"],
-		"BitfinexLTCBidPrice":   prices["Bitfinex-LTC-Bid"],
-		"CexioLTCAskPrice":      prices["Cexio-LTC-Ask"],
-		"CexioLTCBidPrice":      prices["Cexio-LTC-Bid"],
-		"ParibuBCHAskPrice":     prices["Paribu-BCH-Ask"],
-		"ParibuBCHBidPrice":     prices["Paribu-BCH-Bid"],
-		"KoineksBCHAskPrice":    prices["Koineks-BCH-Ask"],
-		"KoineksBCHBidPrice":    prices["Koineks-BCH-Bid"],
-		"KoinimBCHAskPrice":     prices["Koinim-BCH-Ask"],
-		"KoinimBCHBidPrice":     prices["Koinim-BCH-Bid"],
-		"VebitcoinBCHAskPrice":  prices["Vebitcoin-BCH-Ask"],
-		"VebitcoinBCHBidPrice":  prices["Vebitcoin-BCH-Bid"],
-		"BitoasisBCHAskPrice":   prices["Bitoasis-BCH-Ask"],
-		"BitoasisBCHBidPrice":   prices["Bitoasis-BCH-Bid"],
-		"CexioBCHAskPrice":      prices["Cexio-BCH-Ask"],
-		"CexioBCHBidPrice":      prices["Cexio-BCH-Bid"],
-		"KoineksETCAskPrice":    prices["Koineks-ETC-Ask"],
-		"KoineksETCBidPrice":    prices["Koineks-ETC-Bid"],
-		"VebitcoinZRXAskPrice":  prices["Vebitcoin-ZRX-Ask"],
-		"VebitcoinZRXBidPrice":  prices["Vebitcoin-ZRX-Bid"],
-		"ParibuUSDTAskPrice":     prices["Paribu-USDT-Ask"],
-		"ParibuUSDTBidPrice":     prices["Paribu-USDT-Bid"],
-		"BTCTurkUSDTAskPrice":   prices["BTCTurk-USDT-Ask"],
-		"BTCTurkUSDTBidPrice":   prices["BTCTurk-USDT-Bid"],
-		"KoineksUSDTAskPrice":   prices["Koineks-USDT-Ask"],
-		"KoineksUSDTBidPrice":   prices["Koineks-USDT-Bid"],
-		"VebitcoinUSDTAskPrice":   prices["Vebitcoin-USDT-Ask"],
-		"VebitcoinUSDTBidPrice":   prices["Vebitcoin-USDT-Bid"],
-		"ParibuDOGEAskPrice":     prices["Paribu-DOGE-Ask"],
-		"ParibuDOGEBidPrice":     prices["Paribu-DOGE-Bid"],
-		"KoineksDOGEAskPrice":   prices["Koineks-DOGE-Ask"],
-		"KoineksDOGEBidPrice":   prices["Koineks-DOGE-Bid"],
-		"KoinimDOGEAskPrice":    prices["Koinim-DOGE-Ask"],
-		"KoinimDOGEBidPrice":    prices["Koinim-DOGE-Bid"],
-		"ParibuXRPAskPrice":     prices["Paribu-XRP-Ask"],
-		"ParibuXRPBidPrice":     prices["Paribu-XRP-Bid"],
-		"BTCTurkXRPAskPrice":    prices["BTCTurk-XRP-Ask"],
-		"BTCTurkXRPBidPrice":    prices["BTCTurk-XRP-Bid"],
-		"KoineksXRPAskPrice":    prices["Koineks-XRP-Ask"],
-		"KoineksXRPBidPrice":    prices["Koineks-XRP-Bid"],
-		"VebitcoinXRPAskPrice":  prices["Vebitcoin-XRP-Ask"],
-		"VebitcoinXRPBidPrice":  prices["Vebitcoin-XRP-Bid"],
-		"BitoasisXRPAskPrice":   prices["Bitoasis-XRP-Ask"],
-		"BitoasisXRPBidPrice":   prices["Bitoasis-XRP-Bid"],
-		"BitfinexXRPAskPrice":   prices["Bitfinex-XRP-Ask"],
-		"BitfinexXRPBidPrice":   prices["Bitfinex-XRP-Bid"],
-		"CexioXRPAskPrice":      prices["Cexio-XRP-Ask"],
-		"CexioXRPBidPrice":      prices["Cexio-XRP-Bid"],
-		"ParibuXLMAskPrice":     prices["Paribu-XLM-Ask"],
-		"ParibuXLMBidPrice":     prices["Paribu-XLM-Bid"],
-		"BTCTurkXLMAskPrice":    prices["BTCTurk-XLM-Ask"],
-		"BTCTurkXLMBidPrice":    prices["BTCTurk-XLM-Bid"],
-		"KoineksXLMAskPrice":    prices["Koineks-XLM-Ask"],
-		"KoineksXLMBidPrice":    prices["Koineks-XLM-Bid"],
-		"VebitcoinXLMAskPrice":  prices["Vebitcoin-XLM-Ask"],
-		"VebitcoinXLMBidPrice":  prices["Vebitcoin-XLM-Bid"],
-		"BitoasisXLMAskPrice":   prices["Bitoasis-XLM-Ask"],
-		"BitoasisXLMBidPrice":   prices["Bitoasis-XLM-Bid"],
-		"BitfinexXLMAskPrice":   prices["Bitfinex-XLM-Ask"],
-		"BitfinexXLMBidPrice":   prices["Bitfinex-XLM-Bid"],
-		"CexioXLMAskPrice":      prices["Cexio-XLM-Ask"],
-		"CexioXLMBidPrice":      prices["Cexio-XLM-Bid"],
-		"ParibuEOSAskPrice":     prices["Paribu-EOS-Ask"],
-		"ParibuEOSBidPrice":     prices["Paribu-EOS-Bid"],
-		"KoineksEOSAskPrice":    prices["Koineks-EOS-Ask"],
-		"KoineksEOSBidPrice":    prices["Koineks-EOS-Bid"],
-		"ParibuLINKAskPrice":     prices["Paribu-LINK-Ask"],
-		"ParibuLINKBidPrice":     prices["Paribu-LINK-Bid"],
-		"BTCTurkLINKAskPrice":    prices["BTCTurk-LINK-Ask"],
-		"BTCTurkLINKBidPrice":    prices["BTCTurk-LINK-Bid"],
-		"VebitcoinLINKAskPrice":  prices["Vebitcoin-LINK-Ask"],
-		"VebitcoinLINKBidPrice":  prices["Vebitcoin-LINK-Bid"],
-		"KoineksDASHAskPrice":    prices["Koineks-DASH-Ask"],
-		"KoineksDASHBidPrice":    prices["Koineks-DASH-Bid"],
-		"KoinimDASHAskPrice":    prices["Koinim-DASH-Ask"],
-		"KoinimDASHBidPrice":    prices["Koinim-DASH-Bid"],
-		"VebitcoinDASHAskPrice":  prices["Vebitcoin-DASH-Ask"],
-		"VebitcoinDASHBidPrice":  prices["Vebitcoin-DASH-Bid"],
-		"KoineksXEMAskPrice":    prices["Koineks-XEM-Ask"],
-		"KoineksXEMBidPrice":    prices["Koineks-XEM-Bid"],
-		"GdaxUSDT":              fmt.Sprintf("%.8f", coinbaseProPrices["USDT"].Ask),
-		"USDTSpread":            fmt.Sprintf("%.2f", spreads[BINANCE+"USDT"]),
-		"ParibuUSDTAsk":         diffs[BINANCE+"-Paribu-USDT-Ask"],
-		"ParibuUSDTBid":         diffs[BINANCE+"-Paribu-USDT-Bid"],
-		"BTCTurkUSDTAsk":        diffs[BINANCE+"-BTCTurk-USDT-Ask"],
-		"BTCTurkUSDTBid":        diffs[BINANCE+"-BTCTurk-USDT-Bid"],
-		"KoineksUSDTAsk":        diffs[BINANCE+"-Koineks-USDT-Ask"],
-		"KoineksUSDTBid":        diffs[BINANCE+"-Koineks-USDT-Bid"],
-		"VebitcoinUSDTAsk":      diffs[BINANCE+"-Vebitcoin-USDT-Ask"],
-		"VebitcoinUSDTBid":      diffs[BINANCE+"-Vebitcoin-USDT-Bid"],
-		"GdaxDOGE":              fmt.Sprintf("%.8f", coinbaseProPrices["DOGE"].Ask),
-		"DOGEAsk":        		 	 fmt.Sprintf("%.8f", crossPrices["DOGE"].Ask),
-		"DOGESpread":     		   fmt.Sprintf("%.2f", spreads[BINANCE+"DOGE"]),
-		"ParibuDOGEAsk":         diffs[exchange+"-Paribu-DOGE-Ask"],
-		"ParibuDOGEBid":         diffs[exchange+"-Paribu-DOGE-Bid"],
-		"KoineksDOGEAsk":        diffs[exchange+"-Koineks-DOGE-Ask"],
-		"KoineksDOGEBid":        diffs[exchange+"-Koineks-DOGE-Bid"],
-		"KoinimDOGEAsk":         diffs[exchange+"-Koinim-DOGE-Ask"],
-		"KoinimDOGEBid":         diffs[exchange+"-Koinim-DOGE-Bid"],
-		"GdaxXEM":               fmt.Sprintf("%.5f", coinbaseProPrices["XEM"].Ask),
-		"XEMAsk":         			 fmt.Sprintf("%.8f", crossPrices["XEM"].Ask),
-		"XEMSpread":             fmt.Sprintf("%.2f", spreads[BINANCE+"XEM"]),
-		"KoineksXEMAsk":         diffs[BINANCE+"-Koineks-XEM-Ask"],
-		"KoineksXEMBid":         diffs[BINANCE+"-Koineks-XEM-Bid"],
-		"BittrexDOGEAskPrice":   fmt.Sprintf("%.8f", prices["BittrexDOGEAsk"]),
-		"BittrexDOGEBidPrice":   fmt.Sprintf("%.8f", prices["BittrexDOGEBid"]),
-		"BittrexDOGEAskVolume":  fmt.Sprintf("%.2f", dogeVolumes["BittrexAsk"]),
-		"BittrexDOGEBidVolume":  fmt.Sprintf("%.2f", dogeVolumes["BittrexBid"]),
-		"BinanceDOGEAskPrice":   fmt.Sprintf("%.8f", prices["BinanceDOGEAsk"]),
-		"BinanceDOGEBidPrice":   fmt.Sprintf("%.8f", prices["BinanceDOGEBid"]),
-		"BinanceDOGEAskVolume":  fmt.Sprintf("%.2f", dogeVolumes["BinanceAsk"]),
-		"BinanceDOGEBidVolume":  fmt.Sprintf("%.2f", dogeVolumes["BinanceBid"]),
-		"Warning":               warning,
+			reference = Price{Exchange: p.Exchange, Currency: p.Currency, ID: p.ID}
+		}
+		reference.Ask = p.Ask * multiplier
+		reference.Bid = p.Bid * multiplier
+		reference.ExchangeTime = p.ExchangeTime
+		reference.ReceivedAt = receivedAt
+		references[p.ID] = reference
+	}
+
+	s.mux.Lock()
+	// Stale quotes are left out of the diffs, the last computed values stay
+	// on the dashboard and are greyed out.
+	staleQuotes := map[string]bool{}
+	for symbol, p := range m.CoinbaseProPrices {
+		if reference, ok := references[symbol]; ok {
+			p = reference
+		}
+		if s.isStale(cfg, p, now) {
+			staleQuotes[p.Exchange+"-"+symbol] = true
+		}
+	}
+
+	s.updateImpliedRates(m, cfg, now)
+
+	var priceLists [][]Price
+	for _, e := range s.activeExchanges(cfg) {
+		var fresh []Price
+		for _, p := range m.ExchangePrices[e.Name()] {
+			if s.isStale(cfg, p, now) {
+				staleQuotes[p.Exchange+"-"+p.ID] = true
+				continue
+			}
+			fresh = append(fresh, p)
+		}
+		priceLists = append(priceLists, fresh)
+	}
+
+	triangles := s.findTriangles(m, cfg, now)
+	s.mux.Unlock()
+
+	m = s.store.Update(func(next *MarketState) {
+		for symbol, reference := range references {
+			next.CoinbaseProPrices[symbol] = reference
+		}
+		next.StaleQuotes = staleQuotes
+		next.Triangles = triangles
 	})
-	mux.Unlock()
+
+	return s.findPriceDifferences(m, cfg, priceLists...)
 }
 
-func SetNotificationLimits(c *gin.Context) {
-	minimumStr := c.Query("minimum")
-	maximumStr := c.Query("maximum")
-	durationStr := c.Query("duration")
-	fiatEnable := c.Query("fiatEnable")
-	pThresholdStr := c.Query("pThreshold")
+type tableCell struct {
+	Key                string
+	Listed             bool
+	Stale              bool
+	Ask, Bid           float64
+	NetAsk, NetBid     float64
+	AskPrice, BidPrice float64
+}
 
-	if minimumStr != "" {
-		minimum, err := strconv.ParseFloat(minimumStr, 64)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
-			return
+// tableRow is a symbol compared against its reference, Coinbase Pro or
+// Binance, named by ReferenceExchange.
+type tableRow struct {
+	Symbol            string
+	ReferenceExchange string
+	Reference         string
+	ReferenceStale    bool
+	Detail            string
+	Cells             []tableCell
+}
+
+func (s *Server) PrintTableWithBinance(c *gin.Context) {
+	m := s.store.Snapshot()
+	s.printTable(c, m, m.BinancePrices)
+}
+
+// printTable renders the dashboard from a single state. Only the values
+// guarded by mux are read under it, the template is rendered without it.
+func (s *Server) printTable(c *gin.Context, m *MarketState, crossPrices map[string]Price) {
+	cfg := s.currentConfig()
+
+	var localExchanges, usdExchanges []Exchange
+	for _, e := range s.activeExchanges(cfg) {
+		if e.Currency() == "USD" {
+			usdExchanges = append(usdExchanges, e)
+		} else {
+			localExchanges = append(localExchanges, e)
 		}
+	}
 
-		MIN_NOTI_PERC = minimum
+	s.mux.Lock()
+	data := gin.H{
+		"Rates":         s.fxRates(cfg),
+		"ReferenceMode": cfg.FX.ReferenceMode,
+		"Stablecoins":   strings.Join(cfg.FX.Stablecoins, "/"),
+		"RatePremiums":  s.ratePremiums(m, cfg, localExchanges),
+		"CoinbasePro":   s.coinbaseProState.String(),
+		"Leaders":       s.sortedLeaders(cfg),
 	}
+	s.mux.Unlock()
+
+	data["Exchanges"] = exchangeNames(localExchanges)
+	data["Rows"] = tableRows(m, localExchanges, crossPrices)
+	data["USDExchanges"] = exchangeNames(usdExchanges)
+	data["USDRows"] = tableRows(m, usdExchanges, crossPrices)
+	data["BittrexDOGEAskPrice"] = fmt.Sprintf("%.8f", m.Prices["BittrexDOGEAsk"])
+	data["BittrexDOGEBidPrice"] = fmt.Sprintf("%.8f", m.Prices["BittrexDOGEBid"])
+	data["BittrexDOGEAskVolume"] = fmt.Sprintf("%.2f", m.DOGEVolumes["BittrexAsk"])
+	data["BittrexDOGEBidVolume"] = fmt.Sprintf("%.2f", m.DOGEVolumes["BittrexBid"])
+	data["BinanceDOGEAskPrice"] = fmt.Sprintf("%.8f", m.Prices["BinanceDOGEAsk"])
+	data["BinanceDOGEBidPrice"] = fmt.Sprintf("%.8f", m.Prices["BinanceDOGEBid"])
+	data["BinanceDOGEAskVolume"] = fmt.Sprintf("%.2f", m.DOGEVolumes["BinanceAsk"])
+	data["BinanceDOGEBidVolume"] = fmt.Sprintf("%.2f", m.DOGEVolumes["BinanceBid"])
+	data["Warning"] = m.Warning
+	data["Triangles"] = s.sortedTriangles(m, cfg)
+
+	c.HTML(http.StatusOK, "index.tmpl", data)
+}
+
+func exchangeNames(list []Exchange) []string {
+	var names []string
+	for _, e := range list {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// tableRows builds one dashboard row per symbol listed on any of the given
+// exchanges.
+func tableRows(s *MarketState, list []Exchange, crossPrices map[string]Price) []tableRow {
+	var rows []tableRow
+	for _, symbol := range s.Symbols {
+		reference := s.CoinbaseProPrices[symbol]
+		row := tableRow{
+			Symbol:            symbol,
+			ReferenceExchange: reference.Exchange,
+			Reference:         formatReferencePrice(reference.Ask),
+			ReferenceStale:    s.StaleQuotes[reference.Exchange+"-"+symbol],
+		}
+
+		detail := fmt.Sprintf("(%%%.2f)", s.Spreads[reference.Exchange+symbol])
+		if crossPrice, ok := crossPrices[symbol]; ok && symbol != "USDT" {
+			detail = fmt.Sprintf("(%.8f) %s", crossPrice.Ask, detail)
+		}
+		row.Detail = detail
+
+		listed := false
+		for _, e := range list {
+			if !containsSymbol(e.Symbols(), symbol) {
+				row.Cells = append(row.Cells, tableCell{})
+				continue
+			}
+
+			listed = true
+			row.Cells = append(row.Cells, tableCell{
+				Key:      e.Name() + "-" + symbol,
+				Listed:   true,
+				Stale:    row.ReferenceStale || s.StaleQuotes[e.Name()+"-"+symbol],
+				Ask:      s.Diffs[fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Ask")],
+				Bid:      s.Diffs[fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Bid")],
+				NetAsk:   s.NetDiffs[fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Ask")],
+				NetBid:   s.NetDiffs[fmt.Sprintf("%s-%s-%s-%s", reference.Exchange, e.Name(), symbol, "Bid")],
+				AskPrice: s.Prices[fmt.Sprintf("%s-%s-%s", e.Name(), symbol, "Ask")],
+				BidPrice: s.Prices[fmt.Sprintf("%s-%s-%s", e.Name(), symbol, "Bid")],
+			})
+		}
+
+		if listed {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+type ratePremium struct {
+	Key                        string
+	Exchange, Symbol           string
+	InterbankAsk, InterbankBid float64
+	ImpliedAsk, ImpliedBid     float64
+}
+
+// ratePremiums compares the premiums of the compare symbols of cfg under the
+// interbank and the stablecoin implied rate. It must be called with mux held.
+func (s *Server) ratePremiums(m *MarketState, cfg *Config, list []Exchange) []ratePremium {
+	now := s.clock.Now()
+
+	var result []ratePremium
+	for _, e := range list {
+		interbank, implied := s.usdRate(e.Currency()), s.impliedRates[e.Currency()]
+		if interbank == 0 || implied == 0 {
+			continue
+		}
+
+		for _, p := range m.ExchangePrices[e.Name()] {
+			reference, ok := m.CoinbaseProPrices[p.ID]
+			if !ok || reference.Ask == 0 || !containsSymbol(cfg.FX.CompareSymbols, p.ID) || s.isStale(cfg, p, now) {
+				continue
+			}
+
+			premium := func(price, rate float64) float64 {
+				return Round((price-reference.Ask*rate)*100/(reference.Ask*rate), .5, 2)
+			}
+			result = append(result, ratePremium{
+				Key:          e.Name() + "-" + p.ID,
+				Exchange:     e.Name(),
+				Symbol:       p.ID,
+				InterbankAsk: premium(p.Ask, interbank),
+				InterbankBid: premium(p.Bid, interbank),
+				ImpliedAsk:   premium(p.Ask, implied),
+				ImpliedBid:   premium(p.Bid, implied),
+			})
+		}
+	}
+	return result
+}
 
-	if maximumStr != "" {
-		maximum, err := strconv.ParseFloat(maximumStr, 64)
+func formatReferencePrice(price float64) string {
+	if price < 1 {
+		return fmt.Sprintf("%.8f", price)
+	}
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+// SetNotificationLimits publishes the settings with the limits of the
+// given parameters, the absent ones keep their value. A reload resets them
+// to the config.
+func (s *Server) SetNotificationLimits(c *gin.Context) {
+	limits := map[string]float64{}
+	for _, name := range []string{"minimum", "maximum", "duration", "pThreshold"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+
+		limit, err := strconv.ParseFloat(value, 64)
 		if err != nil {
 			c.String(http.StatusInternalServerError, err.Error())
 			return
 		}
+		limits[name] = limit
+	}
 
-		MAX_NOTI_PERC = maximum
+	set := s.settings.Update(func(next *Settings) {
+		n := &next.Config.Notification
+		if limit, ok := limits["minimum"]; ok {
+			n.Minimum = limit
+		}
+		if limit, ok := limits["maximum"]; ok {
+			n.Maximum = limit
+		}
+		if limit, ok := limits["duration"]; ok {
+			n.Duration = limit
+		}
+		if limit, ok := limits["pThreshold"]; ok {
+			n.PairThreshold = limit
+		}
+
+		switch c.Query("fiatEnable") {
+		case "true":
+			n.FiatEnabled = true
+		case "false":
+			n.FiatEnabled = false
+		}
+
+		switch c.Query("pairEnable") {
+		case "true":
+			n.PairEnabled = true
+		case "false":
+			n.PairEnabled = false
+		}
+	})
+
+	n := set.Config.Notification
+	c.HTML(http.StatusOK, "notification.tmpl", gin.H{
+		"Minimum":    n.Minimum,
+		"Maximum":    n.Maximum,
+		"Duration":   n.Duration,
+		"PThreshold": n.PairThreshold,
+		"FiatEnable": n.FiatEnabled,
+		"PairEnable": n.PairEnabled,
+	})
+}
+
+// GetHistory answers time range queries on the recorded series, a page of
+// limit records at a time; next is the offset of the following page. If a
+// threshold is given, the time each series spent above it in the whole range
+// is returned too, for ranges of up to HISTORY_THRESHOLD_LIMIT records.
+func (s *Server) GetHistory(c *gin.Context) {
+	to := s.clock.Now()
+	from := to.Add(-24 * time.Hour)
+
+	var err error
+	if fromStr := c.Query("from"); fromStr != "" {
+		if from, err = time.Parse(time.RFC3339, fromStr); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	if durationStr != "" {
-		duration, err := strconv.ParseFloat(durationStr, 64)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = time.Parse(time.RFC3339, toStr); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
 			return
 		}
+	}
 
-		DURATION = duration
+	offset, limit := 0, HISTORY_QUERY_LIMIT
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			c.String(http.StatusBadRequest, "invalid offset %s", offsetStr)
+			return
+		}
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 || limit > HISTORY_MAX_QUERY_LIMIT {
+			c.String(http.StatusBadRequest, "limit must be between 1 and %d", HISTORY_MAX_QUERY_LIMIT)
+			return
+		}
 	}
 
-	if pThresholdStr != "" {
-		pThreshold, err := strconv.ParseFloat(pThresholdStr, 64)
-		if err != nil {
-			c.String(http.StatusInternalServerError, err.Error())
+	var threshold float64
+	thresholdStr := c.Query("threshold")
+	if thresholdStr != "" {
+		if threshold, err = strconv.ParseFloat(thresholdStr, 64); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
 			return
 		}
+	}
 
-		PAIR_THRESHOLD = pThreshold
+	q := HistoryQuery{
+		Kind:      c.Query("kind"),
+		Reference: c.Query("reference"),
+		Exchange:  c.Query("exchange"),
+		Symbol:    c.Query("symbol"),
+		Side:      c.Query("side"),
+		From:      from,
+		To:        to,
+		Offset:    offset,
+		Limit:     limit,
+	}
+	// The time above the threshold needs every record of the range, only
+	// the returned ones are paged.
+	if thresholdStr != "" {
+		q.Offset, q.Limit = 0, HISTORY_THRESHOLD_LIMIT
 	}
 
-	switch fiatEnable {
-	case "true":
-		fiatNotificationEnabled = true
-	case "false":
-		fiatNotificationEnabled = false
-	default:
-		fiatNotificationEnabled = false
+	records, more, err := s.history.Query(q)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if thresholdStr != "" && more {
+		c.String(http.StatusBadRequest, "the range holds more than %d records, narrow it to get the time above the threshold", HISTORY_THRESHOLD_LIMIT)
+		return
 	}
 
-	c.HTML(http.StatusOK, "notification.tmpl", gin.H{
-		"Minimum":    MIN_NOTI_PERC,
-		"Maximum":    MAX_NOTI_PERC,
-		"Duration":   DURATION,
-		"PThreshold": PAIR_THRESHOLD,
-	})
+	response := gin.H{"from": from, "to": to}
+	if thresholdStr != "" {
+		secondsAbove := map[string]float64{}
+		for key, d := range DurationAbove(records, threshold, to) {
+			secondsAbove[key] = d.Seconds()
+		}
+		response["threshold"] = threshold
+		response["secondsAbove"] = secondsAbove
+
+		records, more = pageHistory(records, offset, limit)
+	}
+
+	response["records"] = records
+	if more {
+		response["next"] = offset + len(records)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func findPriceDifferences(priceLists ...[]Price) {
-	for _, symbol := range ALL_SYMBOLS {
-		var tryList []Price
-		var aedList []Price
+// findPriceDifferences groups the quotes of every symbol by currency and
+// compares each group with the reference price of s converted to that
+// currency. The diffs are published at once and the new state is returned.
+func (s *Server) findPriceDifferences(m *MarketState, cfg *Config, priceLists ...[]Price) *MarketState {
+	now := s.clock.Now()
 
-		originP := coinbaseProPrices[symbol]
-		tryP := Price{Currency: "TRY", Exchange: originP.Exchange, ID: originP.ID, Bid: originP.Bid * tryRate, Ask: originP.Ask * tryRate}
-		aedP := Price{Currency: "AED", Exchange: originP.Exchange, ID: originP.ID, Bid: originP.Bid * aedRate, Ask: originP.Ask * aedRate}
-		tryList = append(tryList, tryP)
-		aedList = append(aedList, aedP)
+	s.mux.Lock()
+	rates := map[string]float64{}
+	for _, list := range priceLists {
+		for _, p := range list {
+			rates[p.Currency] = s.referenceRate(cfg, p.Currency)
+		}
+	}
+	s.mux.Unlock()
 
+	result := newMarketState()
+	for _, symbol := range m.Symbols {
+		originP := m.CoinbaseProPrices[symbol]
+		if m.StaleQuotes[originP.Exchange+"-"+symbol] {
+			continue
+		}
+
+		lists := map[string][]Price{}
 		for _, list := range priceLists {
 			for _, p := range list {
-				if p.ID == symbol {
-					switch p.Currency {
-					case "TRY":
-						tryList = append(tryList, p)
-					case "AED":
-						aedList = append(aedList, p)
-					}
+				if p.ID != symbol {
+					continue
 				}
+
+				if _, ok := lists[p.Currency]; !ok {
+					rate := rates[p.Currency]
+					lists[p.Currency] = []Price{{Currency: p.Currency, Exchange: originP.Exchange, ID: originP.ID, Bid: originP.Bid * rate, Ask: originP.Ask * rate}}
+				}
+				lists[p.Currency] = append(lists[p.Currency], p)
 			}
 		}
 
-		setDiffsAndPrices(tryList)
-		setDiffsAndPrices(aedList)
+		spread := m.Spreads[originP.Exchange+symbol]
+		s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_SPREAD, Exchange: originP.Exchange, Symbol: symbol, Value: spread})
+
+		for _, list := range lists {
+			s.setDiffsAndPrices(cfg, now, result, list)
+		}
 	}
+
+	return s.store.Update(func(next *MarketState) {
+		for key, diff := range result.Diffs {
+			next.Diffs[key] = diff
+		}
+		for key, diff := range result.NetDiffs {
+			next.NetDiffs[key] = diff
+		}
+		for key, price := range result.Prices {
+			next.Prices[key] = price
+		}
+		for exchange, diff := range result.MinDiffs {
+			next.MinDiffs[exchange] = diff
+			next.MinSymbol[exchange] = result.MinSymbol[exchange]
+		}
+		for exchange, diff := range result.MaxDiffs {
+			next.MaxDiffs[exchange] = diff
+			next.MaxSymbol[exchange] = result.MaxSymbol[exchange]
+		}
+	})
 }
 
-func setDiffsAndPrices(list []Price) {
+// setDiffsAndPrices compares the quotes of list with its first one, the
+// reference, and keeps the diffs in result.
+func (s *Server) setDiffsAndPrices(cfg *Config, now time.Time, result *MarketState, list []Price) {
 	firstExchange := ""
 	firstAsk := 0.0
+	notional := 0.0
 	for i, p := range list {
 		if i == 0 {
 			firstAsk = p.Ask
 			firstExchange = p.Exchange
+			// No conversion rate yet, the diffs would all be -100%.
+			if firstAsk == 0 {
+				return
+			}
+
+			s.mux.Lock()
+			notional = s.tradeNotional(p.Currency)
+			s.mux.Unlock()
 		} else {
 			askPercentage := (p.Ask - firstAsk) * 100 / firstAsk
 			bidPercentage := (p.Bid - firstAsk) * 100 / firstAsk
 
 			askRound := Round(askPercentage, .5, 2)
 			bidRound := Round(bidPercentage, .5, 2)
+			netAsk, netBid := calculateNetDiffs(cfg, firstExchange, firstAsk, p, notional)
 
-			mux.Lock()
-			diffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Ask")] = askRound
-			diffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Bid")] = bidRound
+			result.Diffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Ask")] = askRound
+			result.Diffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Bid")] = bidRound
+			result.NetDiffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Ask")] = netAsk
+			result.NetDiffs[fmt.Sprintf("%s-%s-%s-%s", firstExchange, p.Exchange, p.ID, "Bid")] = netBid
 
-			prices[fmt.Sprintf("%s-%s-%s", p.Exchange, p.ID, "Ask")] = p.Ask
-			prices[fmt.Sprintf("%s-%s-%s", p.Exchange, p.ID, "Bid")] = p.Bid
-			mux.Unlock()
+			result.Prices[fmt.Sprintf("%s-%s-%s", p.Exchange, p.ID, "Ask")] = p.Ask
+			result.Prices[fmt.Sprintf("%s-%s-%s", p.Exchange, p.ID, "Bid")] = p.Bid
 
-			maxD := maxDiffs[p.Exchange]
-			minD, ok := minDiffs[p.Exchange]
+			minD, ok := result.MinDiffs[p.Exchange]
 			if !ok {
 				minD = 100
 			}
+			maxD, ok := result.MaxDiffs[p.Exchange]
+			if !ok {
+				maxD = -100
+			}
 
 			if askRound < minD {
-				minDiffs[p.Exchange] = askRound
-				minSymbol[p.Exchange] = p.ID
+				result.MinDiffs[p.Exchange] = askRound
+				result.MinSymbol[p.Exchange] = p.ID
 			}
 
 			if bidRound > maxD {
-				maxDiffs[p.Exchange] = bidRound
-				maxSymbol[p.Exchange] = p.ID
+				result.MaxDiffs[p.Exchange] = bidRound
+				result.MaxSymbol[p.Exchange] = p.ID
 			}
+
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_DIFF, Reference: firstExchange, Exchange: p.Exchange, Symbol: p.ID, Side: "Ask", Value: askRound})
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_DIFF, Reference: firstExchange, Exchange: p.Exchange, Symbol: p.ID, Side: "Bid", Value: bidRound})
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_NET_DIFF, Reference: firstExchange, Exchange: p.Exchange, Symbol: p.ID, Side: "Ask", Value: netAsk})
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_NET_DIFF, Reference: firstExchange, Exchange: p.Exchange, Symbol: p.ID, Side: "Bid", Value: netBid})
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_PRICE, Exchange: p.Exchange, Symbol: p.ID, Side: "Ask", Value: p.Ask})
+			s.recordHistory(HistoryRecord{Time: now, Kind: HISTORY_PRICE, Exchange: p.Exchange, Symbol: p.ID, Side: "Bid", Value: p.Bid})
 		}
 	}
 }
@@ -686,22 +1120,24 @@ func Round(val float64, roundOn float64, places int) (newVal float64) {
 	return
 }
 
-func resetDiffsAndSymbols() {
-	for key, _ := range minDiffs {
-		minDiffs[key] = 100
-	}
+func (s *Server) resetDiffsAndSymbols() {
+	s.store.Update(func(next *MarketState) {
+		for key, _ := range next.MinDiffs {
+			next.MinDiffs[key] = 100
+		}
 
-	for key, _ := range maxDiffs {
-		maxDiffs[key] = -100
-	}
+		for key, _ := range next.MaxDiffs {
+			next.MaxDiffs[key] = -100
+		}
 
-	for key, _ := range minSymbol {
-		minSymbol[key] = ""
-	}
+		for key, _ := range next.MinSymbol {
+			next.MinSymbol[key] = ""
+		}
 
-	for key, _ := range maxSymbol {
-		maxSymbol[key] = ""
-	}
+		for key, _ := range next.MaxSymbol {
+			next.MaxSymbol[key] = ""
+		}
 
-	warning = ""
+		next.Warning = ""
+	})
 }
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MarketState is one version of the quotes and of the values derived from
+// them. A published state is never modified, so it can be read without a
+// lock; writers publish a changed copy with MarketStore.Update.
+type MarketState struct {
+	// Symbols are the symbols the state was built for, the configured ones
+	// at the time.
+	Symbols              []string
+	Diffs, NetDiffs      map[string]float64
+	Prices, Spreads      map[string]float64
+	MinDiffs, MaxDiffs   map[string]float64
+	DOGEVolumes          map[string]float64
+	MinSymbol, MaxSymbol map[string]string
+	BinancePrices        map[string]Price
+	// CoinbaseProPrices holds the reference price of every symbol, the ones
+	// Coinbase Pro does not list are Binance prices converted to USD.
+	CoinbaseProPrices map[string]Price
+	// ExchangePrices and BTCPairPrices are keyed by exchange. The lists are
+	// replaced, never changed in place.
+	ExchangePrices map[string][]Price
+	BTCPairPrices  map[string][]Price
+	QuoteTimes     map[string]time.Time
+	StaleQuotes    map[string]bool
+	// Triangles is rebuilt with every diff calculation, keyed by
+	// exchange-symbol.
+	Triangles map[string]Triangle
+	Warning   string
+	Version   uint64
+}
+
+func newMarketState() *MarketState {
+	return &MarketState{
+		Diffs:             map[string]float64{},
+		NetDiffs:          map[string]float64{},
+		Prices:            map[string]float64{},
+		Spreads:           map[string]float64{},
+		MinDiffs:          map[string]float64{},
+		MaxDiffs:          map[string]float64{},
+		DOGEVolumes:       map[string]float64{},
+		MinSymbol:         map[string]string{},
+		MaxSymbol:         map[string]string{},
+		BinancePrices:     map[string]Price{},
+		CoinbaseProPrices: map[string]Price{},
+		ExchangePrices:    map[string][]Price{},
+		BTCPairPrices:     map[string][]Price{},
+		QuoteTimes:        map[string]time.Time{},
+		StaleQuotes:       map[string]bool{},
+		Triangles:         map[string]Triangle{},
+	}
+}
+
+func (s *MarketState) clone() *MarketState {
+	next := newMarketState()
+	next.Diffs = copyFloats(s.Diffs)
+	next.NetDiffs = copyFloats(s.NetDiffs)
+	next.Prices = copyFloats(s.Prices)
+	next.Spreads = copyFloats(s.Spreads)
+	next.MinDiffs = copyFloats(s.MinDiffs)
+	next.MaxDiffs = copyFloats(s.MaxDiffs)
+	next.DOGEVolumes = copyFloats(s.DOGEVolumes)
+
+	for k, v := range s.MinSymbol {
+		next.MinSymbol[k] = v
+	}
+	for k, v := range s.MaxSymbol {
+		next.MaxSymbol[k] = v
+	}
+	next.BinancePrices = copyPrices(s.BinancePrices)
+	next.CoinbaseProPrices = copyPrices(s.CoinbaseProPrices)
+	for k, v := range s.ExchangePrices {
+		next.ExchangePrices[k] = v
+	}
+	for k, v := range s.BTCPairPrices {
+		next.BTCPairPrices[k] = v
+	}
+	next.QuoteTimes = copyTimes(s.QuoteTimes)
+	for k, v := range s.StaleQuotes {
+		next.StaleQuotes[k] = v
+	}
+	for k, v := range s.Triangles {
+		next.Triangles[k] = v
+	}
+
+	next.Symbols = s.Symbols
+	next.Warning = s.Warning
+	next.Version = s.Version
+	return next
+}
+
+func copyFloats(src map[string]float64) map[string]float64 {
+	dst := make(map[string]float64, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func copyPrices(src map[string]Price) map[string]Price {
+	dst := make(map[string]Price, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+func copyTimes(src map[string]time.Time) map[string]time.Time {
+	dst := make(map[string]time.Time, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// MarketStore publishes the market states. Readers take the current state
+// with Snapshot and keep a consistent view for as long as they hold it.
+type MarketStore struct {
+	// mu serializes the writers, the readers never wait on it.
+	mu      sync.Mutex
+	current atomic.Value
+}
+
+func NewMarketStore() *MarketStore {
+	s := &MarketStore{}
+	s.current.Store(newMarketState())
+	return s
+}
+
+// Snapshot returns the current state, which must not be modified.
+func (s *MarketStore) Snapshot() *MarketState {
+	return s.current.Load().(*MarketState)
+}
+
+// Update calls fn with a copy of the current state and publishes it. fn must
+// not lock mux, applyConfig updates the store with mux held.
+func (s *MarketStore) Update(fn func(next *MarketState)) *MarketState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.Snapshot().clone()
+	fn(next)
+	next.Version++
+	s.current.Store(next)
+	return next
+}
+
+// UpdateShallow is Update for the writers changing a few maps many times a
+// second, like the streamed feeds. The copy fn is called with shares the maps
+// of the current state, fn must replace the ones it changes with copies.
+func (s *MarketStore) UpdateShallow(fn func(next *MarketState)) *MarketState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := *s.Snapshot()
+	fn(&next)
+	next.Version++
+	s.current.Store(&next)
+	return &next
+}
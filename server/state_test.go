@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	coinbasepro "github.com/preichenberger/go-coinbasepro"
+)
+
+func TestCoinbaseProTickKeepsTheSnapshots(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := &Server{store: NewMarketStore(), clock: testClock{now}}
+	s.store.Update(func(next *MarketState) {
+		next.Spreads[GDAX+"BTC"] = 5
+		next.Diffs[PARIBU+"BTCAsk"] = 2
+	})
+	before := s.store.Snapshot()
+
+	s.setCoinbaseProPrice(coinbasepro.Message{ProductID: "BTC-USD", BestAsk: "101", BestBid: "100"})
+
+	after := s.store.Snapshot()
+	if after.Version != before.Version+1 {
+		t.Errorf("version is %d, want %d", after.Version, before.Version+1)
+	}
+	if before.Spreads[GDAX+"BTC"] != 5 || len(before.CoinbaseProPrices) != 0 || len(before.QuoteTimes) != 0 {
+		t.Errorf("the previous snapshot changed : %v %v %v", before.Spreads, before.CoinbaseProPrices, before.QuoteTimes)
+	}
+
+	if after.Spreads[GDAX+"BTC"] != 1 || !after.QuoteTimes[GDAX+"-BTC"].Equal(now) {
+		t.Errorf("tick was not applied : %v %v", after.Spreads, after.QuoteTimes)
+	}
+	if p := after.CoinbaseProPrices["BTC"]; p.Ask != 101 || p.Bid != 100 || !p.ReceivedAt.Equal(now) {
+		t.Errorf("reference price is %+v", p)
+	}
+	if after.Diffs[PARIBU+"BTCAsk"] != 2 {
+		t.Errorf("the untouched maps lost their values : %v", after.Diffs)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	STREAM_BUFFER_SIZE = 16
+)
+
+type streamEvent struct {
+	Name string
+	Data streamUpdate
+}
+
+type streamUpdate struct {
+	Time  time.Time         `json:"time"`
+	Cells map[string]string `json:"cells"`
+}
+
+// streamBroadcaster keeps the last published dashboard cells and fans the
+// changed ones out to every subscriber.
+type streamBroadcaster struct {
+	mu          sync.Mutex
+	cells       map[string]string
+	time        time.Time
+	subscribers map[chan streamEvent]bool
+}
+
+func newStreamBroadcaster() *streamBroadcaster {
+	return &streamBroadcaster{
+		cells:       map[string]string{},
+		subscribers: map[chan streamEvent]bool{},
+	}
+}
+
+// subscribe registers a new subscriber and returns it along with the full
+// set of cells it has to start from.
+func (b *streamBroadcaster) subscribe() (chan streamEvent, streamUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan streamEvent, STREAM_BUFFER_SIZE)
+	b.subscribers[ch] = true
+
+	cells := map[string]string{}
+	for id, value := range b.cells {
+		cells[id] = value
+	}
+	return ch, streamUpdate{Time: b.time, Cells: cells}
+}
+
+func (b *streamBroadcaster) unsubscribe(ch chan streamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[ch] {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close ends the streams of every subscriber.
+func (b *streamBroadcaster) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// publish sends the cells that differ from the previous publication. A
+// subscriber that cannot keep up is dropped, its browser reconnects and
+// starts again from a full snapshot.
+func (b *streamBroadcaster) publish(now time.Time, cells map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delta := map[string]string{}
+	for id, value := range cells {
+		if old, ok := b.cells[id]; !ok || old != value {
+			delta[id] = value
+		}
+	}
+	b.cells = cells
+	b.time = now
+
+	if len(delta) == 0 {
+		return
+	}
+
+	event := streamEvent{Name: "delta", Data: streamUpdate{Time: now, Cells: delta}}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishDashboard pushes the current dashboard cells to the stream
+// subscribers.
+func (s *Server) publishDashboard(cfg *Config) {
+	m := s.store.Snapshot()
+
+	s.mux.Lock()
+	cells := map[string]string{
+		"Warning":     m.Warning,
+		"CoinbasePro": s.coinbaseProState.String(),
+	}
+	for _, rate := range s.fxRates(cfg) {
+		cells["USD"+rate.Currency] = fmt.Sprint(rate.Rate)
+		cells["ImpliedUSD"+rate.Currency] = fmt.Sprint(rate.Implied)
+	}
+	for _, premium := range s.ratePremiums(m, cfg, s.activeExchanges(cfg)) {
+		cells[premium.Key+"-Interbank-Ask"] = fmt.Sprint(premium.InterbankAsk)
+		cells[premium.Key+"-Interbank-Bid"] = fmt.Sprint(premium.InterbankBid)
+		cells[premium.Key+"-Implied-Ask"] = fmt.Sprint(premium.ImpliedAsk)
+		cells[premium.Key+"-Implied-Bid"] = fmt.Sprint(premium.ImpliedBid)
+	}
+	for _, leader := range s.sortedLeaders(cfg) {
+		cells[leader.Exchange+"-Leader-Buy"] = leader.Buy
+		cells[leader.Exchange+"-Leader-Buy-Diff"] = fmt.Sprint(leader.BuyDiff)
+		cells[leader.Exchange+"-Leader-Sell"] = leader.Sell
+		cells[leader.Exchange+"-Leader-Sell-Diff"] = fmt.Sprint(leader.SellDiff)
+	}
+	s.mux.Unlock()
+
+	for _, t := range s.sortedTriangles(m, cfg) {
+		cells[t.Exchange+"-"+t.Symbol+"-Forward"] = fmt.Sprint(t.Forward)
+		cells[t.Exchange+"-"+t.Symbol+"-Reverse"] = fmt.Sprint(t.Reverse)
+	}
+	for _, row := range tableRows(m, s.activeExchanges(cfg), m.BinancePrices) {
+		cells[row.Symbol+"-Reference-Exchange"] = row.ReferenceExchange
+		cells[row.Symbol+"-Reference"] = row.Reference
+		cells[row.Symbol+"-Detail"] = row.Detail
+		cells[row.Symbol+"-Reference-Stale"] = fmt.Sprint(row.ReferenceStale)
+		for _, cell := range row.Cells {
+			if !cell.Listed {
+				continue
+			}
+			cells[cell.Key+"-Stale"] = fmt.Sprint(cell.Stale)
+			cells[cell.Key+"-Ask"] = fmt.Sprint(cell.Ask)
+			cells[cell.Key+"-Bid"] = fmt.Sprint(cell.Bid)
+			cells[cell.Key+"-Net-Ask"] = fmt.Sprint(cell.NetAsk)
+			cells[cell.Key+"-Net-Bid"] = fmt.Sprint(cell.NetBid)
+			cells[cell.Key+"-Ask-Price"] = fmt.Sprint(cell.AskPrice)
+			cells[cell.Key+"-Bid-Price"] = fmt.Sprint(cell.BidPrice)
+		}
+	}
+
+	s.stream.publish(s.clock.Now(), cells)
+}
+
+// StreamDashboard sends the dashboard cells as Server-Sent Events: a full
+// "snapshot" on connect followed by a "delta" with the changed cells after
+// every recomputation.
+func (s *Server) StreamDashboard(c *gin.Context) {
+	ch, snapshot := s.stream.subscribe()
+	defer s.stream.unsubscribe(ch)
+
+	c.Header("Cache-Control", "no-cache")
+	c.SSEvent("snapshot", snapshot)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Name, event.Data)
+			return true
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// CrossExchange is an exchange that also lists altcoins against BTC. The
+// returned prices have BTC as their currency.
+type CrossExchange interface {
+	Exchange
+	FetchCrossTickers(ctx context.Context) ([]Price, error)
+}
+
+// Triangle is the return of the two cycles through the local currency, BTC
+// and an altcoin on a single exchange, in percent after the taker fees.
+// Forward buys BTC, trades it for the altcoin and sells the altcoin, Reverse
+// buys the altcoin, trades it for BTC and sells the BTC.
+type Triangle struct {
+	Exchange  string    `json:"exchange"`
+	Symbol    string    `json:"symbol"`
+	Currency  string    `json:"currency"`
+	Forward   float64   `json:"forward"`
+	Reverse   float64   `json:"reverse"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// findTriangles walks the cycles of every exchange with BTC-quoted books in
+// m. Stale quotes are left out. It must be called with mux held.
+func (s *Server) findTriangles(m *MarketState, cfg *Config, now time.Time) map[string]Triangle {
+	triangles := map[string]Triangle{}
+	for _, e := range s.activeExchanges(cfg) {
+		if _, ok := e.(CrossExchange); !ok {
+			continue
+		}
+
+		local := map[string]Price{}
+		for _, p := range m.ExchangePrices[e.Name()] {
+			if !s.isStale(cfg, p, now) {
+				local[p.ID] = p
+			}
+		}
+
+		bitcoin, ok := local["BTC"]
+		if !ok {
+			continue
+		}
+
+		for _, cross := range m.BTCPairPrices[e.Name()] {
+			alt, ok := local[cross.ID]
+			if !ok || s.isStale(cfg, cross, now) {
+				continue
+			}
+
+			forward, reverse, ok := cycleReturns(feeSchedule(cfg, e.Name()).TakerPercent, bitcoin, cross, alt)
+			if !ok {
+				continue
+			}
+
+			triangles[e.Name()+"-"+cross.ID] = Triangle{
+				Exchange:  e.Name(),
+				Symbol:    cross.ID,
+				Currency:  e.Currency(),
+				Forward:   forward,
+				Reverse:   reverse,
+				UpdatedAt: now,
+			}
+		}
+	}
+	return triangles
+}
+
+// cycleReturns starts both cycles with one unit of the local currency and
+// pays the taker fee on each of the three legs.
+func cycleReturns(takerPercent float64, bitcoin, cross, alt Price) (float64, float64, bool) {
+	if bitcoin.Ask <= 0 || bitcoin.Bid <= 0 || cross.Ask <= 0 || cross.Bid <= 0 || alt.Ask <= 0 || alt.Bid <= 0 {
+		return 0, 0, false
+	}
+
+	fee := takerPercent / 100
+	btc := 1 / (bitcoin.Ask * (1 + fee))
+	forward := btc / (cross.Ask * (1 + fee)) * alt.Bid * (1 - fee)
+
+	units := 1 / (alt.Ask * (1 + fee))
+	reverse := units * cross.Bid * (1 - fee) * bitcoin.Bid * (1 - fee)
+
+	return Round((forward-1)*100, .5, 2), Round((reverse-1)*100, .5, 2), true
+}
+
+// sortedTriangles lists the triangles of m in exchange and symbol order.
+func (s *Server) sortedTriangles(m *MarketState, cfg *Config) []Triangle {
+	var list []Triangle
+	for _, e := range s.activeExchanges(cfg) {
+		for _, symbol := range m.Symbols {
+			if t, ok := m.Triangles[e.Name()+"-"+symbol]; ok {
+				list = append(list, t)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+const (
+	VEBITCOIN_URI = "https://prod-data-publisher.azurewebsites.net/api/ticker"
+)
+
+var (
+	vebitcoinCurrencies = []string{"BTC", "ETH", "LTC", "BCH", "ZRX", "XRP", "XLM", "USDT", "LINK", "DASH"}
+)
+
+type vebitcoinExchange struct {
+	venue
+}
+
+func init() {
+	registerExchange(func(v venue) Exchange { return vebitcoinExchange{v} })
+}
+
+func (vebitcoinExchange) Name() string {
+	return VEBITCOIN
+}
+
+func (e vebitcoinExchange) Currency() string {
+	return e.configuredCurrency(VEBITCOIN, "TRY")
+}
+
+func (e vebitcoinExchange) Symbols() []string {
+	return e.configuredSymbols(VEBITCOIN, vebitcoinCurrencies)
+}
+
+func (e vebitcoinExchange) FetchTickers(ctx context.Context) ([]Price, error) {
+	var prices []Price
+	quote, symbols := e.Currency(), e.Symbols()
+
+	responseData, err := e.httpGet(ctx, VEBITCOIN, VEBITCOIN_URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Vebitcoin response: %s", err)
+	}
+
+	var returnError error
+	jsonparser.ArrayEach(responseData, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		targetCoin, err := jsonparser.GetString(value, "TargetCoinCode")
+		if err != nil {
+			returnError = fmt.Errorf("failed to find the code for target coin name in Vebitcoin: %s", err)
+			return
+		}
+		if targetCoin != quote {
+			return
+		}
+
+		sourceCoin, err := jsonparser.GetString(value, "SourceCoinCode")
+		if err != nil {
+			returnError = fmt.Errorf("failed to find the code for source coin name in Vebitcoin: %s", err)
+			return
+		}
+		if !containsSymbol(symbols, sourceCoin) {
+			return
+		}
+
+		// Vebitcoin has a bug in their API, the ask price is given in the "Bid" field, bid price is given in their
+		// "Ask" field.
+		pAsk, err := jsonparser.GetFloat(value, "Ask")
+		if err != nil {
+			returnError = fmt.Errorf("failed to find the ask price for %s in Vebitcoin: %s", sourceCoin, err)
+			return
+		}
+		pBid, err := jsonparser.GetFloat(value, "Bid")
+		if err != nil {
+			returnError = fmt.Errorf("failed to find the bid price for %s in Vebitcoin: %s", sourceCoin, err)
+			return
+		}
+		prices = append(prices, Price{Exchange: VEBITCOIN, Currency: quote, ID: sourceCoin, Ask: pAsk, Bid: pBid})
+	})
+
+	if returnError != nil {
+		return nil, returnError
+	}
+
+	return prices, nil
+}